@@ -1,141 +1,158 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
+	"context"
+	"flag"
 	"log"
-	"net"
 	"strconv"
 	"time"
+
+	"Xo-xo-touch/xoclient"
 )
 import "fmt"
 
-type ResToken struct {
-	Token string `json:"token"`
-}
-
 func catch(err error) {
 	if err != nil {
 		log.Println(err)
 	}
 }
 
+var (
+	reqAddr     = flag.String("req", "127.0.0.1:8081", "address of the request port")
+	brcastAddr  = flag.String("brcast", "127.0.0.1:8082", "address of the broadcast port")
+	useTls      = flag.Bool("tls", false, "connect over TLS")
+	tlsCaFile   = flag.String("tlsca", "", "CA certificate (pem) to verify the server, system CAs if empty")
+	tlsInsecure = flag.Bool("tlsinsecure", false, "do not verify the server certificate (self-signed, testing only)")
+)
+
 const sleepConst = 100
 const sleepBetweenConst = 2
 
-func printRequest(conn net.Conn, reqType string, token string) {
-	res, err := bufio.NewReader(conn).ReadString('}')
-	catch(err)
-	fmt.Println("Request " + token[len(token)-3:] + " (" + reqType + "): " + res)
+func printResponse(reqType string, token string, res any, err error) {
+	if err != nil {
+		fmt.Println("Request " + token[len(token)-3:] + " (" + reqType + "): " + err.Error())
+	} else {
+		fmt.Printf("Request %s (%s): %+v\n", token[len(token)-3:], reqType, res)
+	}
 	time.Sleep(sleepConst * time.Millisecond)
 }
 
-func printBroadcast(conn2 net.Conn) {
-	res2, err := bufio.NewReader(conn2).ReadString('}')
-	catch(err)
-	fmt.Println("\nBroadcast: " + res2 + "\n")
-	//time.Sleep(sleepConst * time.Millisecond)
+func printBroadcasts(c *xoclient.Client) {
+	for event := range c.Events() {
+		fmt.Println("\nBroadcast: " + string(event.Raw) + "\n")
+	}
 }
 
-func registerAndEntergame(conn net.Conn, conn2 net.Conn, usernames []string) []string {
+func registerAndEntergame(ctx context.Context, c *xoclient.Client, usernames []string) []string {
 	tokens := []string{}
 	for _, u := range usernames {
 		// Register
-		fmt.Fprintf(conn, "{\"method\": \"register\", \"username\": \""+u+"\", \"password\": \"parol123\"}\n")
-		res, err := bufio.NewReader(conn).ReadString('}')
+		res, err := c.Register(ctx, u, "parol123")
 		catch(err)
 		fmt.Println("Request (register): ...")
 		time.Sleep(sleepConst * time.Millisecond)
-		resToken := ResToken{}
-		err = json.Unmarshal([]byte(res), &resToken)
-		catch(err)
-		token := resToken.Token
-		tokens = append(tokens, token)
+		if err != nil {
+			continue
+		}
+		tokens = append(tokens, res.Token)
 
 		// Entergame
-		fmt.Fprintf(conn, "{\"method\": \"entergame\", \"token\": \""+token+"\"}\n")
-		printRequest(conn, "entergame", token)
-
-		go printBroadcast(conn2)
+		players, err := c.EnterGame(ctx)
+		printResponse("entergame", res.Token, players, err)
 	}
 	return tokens
 }
 
-func saveAnswers(conn net.Conn, conn2 net.Conn, tokens []string) {
+func saveAnswers(ctx context.Context, c *xoclient.Client, tokens []string) {
 	for qn := range []int{0, 1} {
 		for i, t := range tokens {
+			c.SetToken(t)
+
 			// Get question
-			fmt.Fprintf(conn, "{\"method\": \"getquestion\", \"token\": \""+t+"\"}\n")
-			printRequest(conn, "getquestion", t)
+			question, err := c.GetQuestion(ctx)
+			printResponse("getquestion", t, question, err)
 
 			// Save answer
-			fmt.Fprintf(conn, "{\"method\": \"saveanswer\", \"token\": \""+t+"\", \"answer\": \"ans "+strconv.Itoa(qn)+"."+strconv.Itoa(i)+"!\"}\n")
-			printRequest(conn, "saveanswer", t)
-
-			go printBroadcast(conn2)
+			answer, err := c.SaveAnswer(ctx, "ans "+strconv.Itoa(qn)+"."+strconv.Itoa(i)+"!")
+			printResponse("saveanswer", t, answer, err)
 		}
 	}
 }
 
-func sendVotes(conn net.Conn, conn2 net.Conn, tokens []string) {
+func sendVotes(ctx context.Context, c *xoclient.Client, tokens []string) {
 	//for i := 0; i < len(tokens) - 2; i++
 	for i := range tokens {
 		fmt.Println("----- Voting:", i)
 		for _, t := range tokens {
+			c.SetToken(t)
+
 			// Get duel
-			fmt.Fprintf(conn, "{\"method\": \"getduel\", \"token\": \""+t+"\"}\n")
-			printRequest(conn, "getduel", t)
+			duel, err := c.GetDuel(ctx)
+			printResponse("getduel", t, duel, err)
 
 			// Save vote
-			fmt.Fprintf(conn, "{\"method\": \"savevote\", \"vote\": 1, \"token\": \""+t+"\"}\n")
-			printRequest(conn, "savevote", t)
+			err = c.SaveVote(ctx, 1)
+			printResponse("savevote", t, "ok", err)
 		}
-
-		go printBroadcast(conn2)
 		//time.Sleep(sleepBetweenConst * time.Second)
 	}
 
-	fmt.Fprint(conn, "{\"method\": \"getroundresult\", \"token\": \""+tokens[0]+"\"}\n")
-	printRequest(conn, "getroundresult", tokens[0])
+	c.SetToken(tokens[0])
+	result, err := c.GetRoundResult(ctx)
+	printResponse("getroundresult", tokens[0], result, err)
 }
 
-func getGameResult(conn net.Conn, conn2 net.Conn, tokens []string) {
-	fmt.Fprint(conn, "{\"method\": \"getgameresult\", \"token\": \""+tokens[0]+"\"}\n")
-	printRequest(conn, "getgameresult", tokens[0])
+func getGameResult(ctx context.Context, c *xoclient.Client, tokens []string) {
+	c.SetToken(tokens[0])
+	result, err := c.GetGameResult(ctx)
+	printResponse("getgameresult", tokens[0], result, err)
 }
 
 func main() {
+	flag.Parse()
+	ctx := context.Background()
+
 	// Подключаемся к сокету
 	fmt.Println("Start client")
-	connReq, err := net.Dial("tcp", "127.0.0.1:8081")
-	catch(err)
-	connBrcast, err := net.Dial("tcp", "127.0.0.1:8082")
-	catch(err)
+	config := &xoclient.Config{}
+	if *useTls {
+		tlsConfig, err := xoclient.NewTLSConfig(*tlsCaFile, *tlsInsecure)
+		if err != nil {
+			log.Fatal(err)
+		}
+		config.TLS = tlsConfig
+	}
+	c, err := xoclient.Dial(ctx, *reqAddr, *brcastAddr, config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+	go printBroadcasts(c)
 
-	tokens := registerAndEntergame(connReq, connBrcast, []string{"dovolniy", "Yuriy", "Andrew", "user4", "user5"})
+	tokens := registerAndEntergame(ctx, c, []string{"dovolniy", "Yuriy", "Andrew", "user4", "user5"})
 	time.Sleep(3 * time.Second)
 
 	// Игра 1
-	saveAnswers(connReq, connBrcast, tokens)
+	saveAnswers(ctx, c, tokens)
 
-	sendVotes(connReq, connBrcast, tokens)
+	sendVotes(ctx, c, tokens)
 
-	printBroadcast(connBrcast)
+	time.Sleep(sleepBetweenConst * time.Second)
 
-	getGameResult(connReq, connBrcast, tokens)
+	getGameResult(ctx, c, tokens)
 
 	time.Sleep(7 * time.Second)
 
-	tokens = registerAndEntergame(connReq, connBrcast, []string{"MOLODOY", "stariy", "kek", "cheburek", "hohotunchik"})
+	tokens = registerAndEntergame(ctx, c, []string{"MOLODOY", "stariy", "kek", "cheburek", "hohotunchik"})
 	time.Sleep(3 * time.Second)
 
 	// Игра 2
-	saveAnswers(connReq, connBrcast, tokens)
+	saveAnswers(ctx, c, tokens)
 
-	sendVotes(connReq, connBrcast, tokens)
+	sendVotes(ctx, c, tokens)
 
-	printBroadcast(connBrcast)
+	time.Sleep(sleepBetweenConst * time.Second)
 
-	getGameResult(connReq, connBrcast, tokens)
+	getGameResult(ctx, c, tokens)
 
 }
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+
+	"Xo-xo-touch/xoclient"
+)
+
+// Прогоняет сценарии (см. Scenario) против сервера и печатает различия.
+// Использование: clientScenario [flags] scenario.json...
+
+var (
+	reqAddr     = flag.String("req", "127.0.0.1:8081", "address of the request port")
+	brcastAddr  = flag.String("brcast", "127.0.0.1:8082", "address of the broadcast port")
+	useTls      = flag.Bool("tls", false, "connect over TLS")
+	tlsCaFile   = flag.String("tlsca", "", "CA certificate (pem) to verify the server, system CAs if empty")
+	tlsInsecure = flag.Bool("tlsinsecure", false, "do not verify the server certificate (self-signed, testing only)")
+	encoding    = flag.String("encoding", "json", "wire encoding to ask the server for: json, msgpack")
+	verbose     = flag.Bool("v", false, "print every response and broadcast")
+)
+
+const broadcastTimeoutConst = 3 // seconds
+
+type Runner struct {
+	Scenario *Scenario
+	Config   *xoclient.Config
+	Clients  map[string]*xoclient.Client
+	Vars     map[string]string
+}
+
+func (r *Runner) connect(ctx context.Context) error {
+	// Сервер связывает соединения в пару по порядку, поэтому актеры подключаются по одному
+	for _, actor := range r.Scenario.Actors {
+		c, err := xoclient.Dial(ctx, *reqAddr, *brcastAddr, r.Config)
+		if err != nil {
+			return fmt.Errorf("actor %s: %w", actor, err)
+		}
+		r.Clients[actor] = c
+	}
+	return nil
+}
+
+func (r *Runner) close() {
+	for _, c := range r.Clients {
+		c.Close()
+	}
+}
+
+// runStep выполняет шаг и возвращает различия с ожидаемым
+func (r *Runner) runStep(ctx context.Context, step *Step) []string {
+	time.Sleep(time.Duration(step.Sleep * float64(time.Second)))
+	c := r.Clients[step.Actor]
+	diffs := []string{}
+
+	if step.Send != nil {
+		req, err := substitute(step.Send, r.Vars)
+		if err != nil {
+			return []string{"send: " + err.Error()}
+		}
+		raw, err := c.Raw(ctx, req)
+		if err != nil {
+			return []string{"send: " + err.Error()}
+		}
+		if *verbose {
+			fmt.Println("        <- " + string(raw))
+		}
+		var resp any
+		err = json.Unmarshal(raw, &resp)
+		if err != nil {
+			return []string{"response: " + err.Error()}
+		}
+
+		if step.Expect != nil {
+			expected, err := substitute(step.Expect, r.Vars)
+			if err != nil {
+				return []string{"expect: " + err.Error()}
+			}
+			diffs = append(diffs, match("response", expected, resp)...)
+		}
+
+		for name, path := range step.Capture {
+			v, ok := lookup(resp, path)
+			if !ok {
+				diffs = append(diffs, fmt.Sprintf("capture %s: no %s in the response", name, path))
+				continue
+			}
+			if s, ok := v.(string); ok {
+				r.Vars[name] = s
+			} else {
+				r.Vars[name] = show(v)
+			}
+		}
+	}
+
+	timeout := step.Timeout
+	if timeout == 0 {
+		timeout = broadcastTimeoutConst
+	}
+	for i, b := range step.Broadcasts {
+		expected, err := substitute(b, r.Vars)
+		if err != nil {
+			diffs = append(diffs, "broadcast: "+err.Error())
+			continue
+		}
+		diffs = append(diffs, r.waitBroadcast(ctx, c, i, expected, timeout)...)
+	}
+	return diffs
+}
+
+// waitBroadcast ждет рассылку, совпадающую с ожиданием. Не совпавшие пропускаются,
+// но если нужная так и не пришла, они попадают в отчет.
+func (r *Runner) waitBroadcast(ctx context.Context, c *xoclient.Client, i int, expected any, timeout float64) []string {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout*float64(time.Second)))
+	defer cancel()
+	path := "broadcasts." + strconv.Itoa(i)
+	skipped := []string{}
+	for {
+		event, err := c.WaitEvent(ctx)
+		if err != nil {
+			diff := fmt.Sprintf("%s: expected %s, got nothing in %gs", path, show(expected), timeout)
+			if len(skipped) > 0 {
+				diff += fmt.Sprintf(" (skipped %v)", skipped)
+			}
+			return []string{diff}
+		}
+		if *verbose {
+			fmt.Println("        <~ " + string(event.Raw))
+		}
+		var actual any
+		err = json.Unmarshal(event.Raw, &actual)
+		if err == nil && len(match(path, expected, actual)) == 0 {
+			return nil
+		}
+		skipped = append(skipped, string(event.Raw))
+	}
+}
+
+func stepTitle(step *Step) string {
+	method := "wait"
+	if step.Send != nil {
+		req := struct {
+			Method string `json:"method"`
+		}{}
+		json.Unmarshal(step.Send, &req)
+		method = req.Method
+	}
+	return step.Actor + " " + method
+}
+
+// run прогоняет сценарий и возвращает число шагов с различиями
+func run(ctx context.Context, scenario *Scenario, runId string, config *xoclient.Config) (int, error) {
+	r := &Runner{
+		Scenario: scenario,
+		Config:   config,
+		Clients:  map[string]*xoclient.Client{},
+		Vars:     map[string]string{"run": runId},
+	}
+	for k, v := range scenario.Vars {
+		r.Vars[k] = v
+	}
+	defer r.close()
+	err := r.connect(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	fmt.Println("scenario " + scenario.Name)
+	failed := 0
+	for i, step := range scenario.Steps {
+		diffs := r.runStep(ctx, step)
+		if len(diffs) == 0 {
+			fmt.Printf("  ok    %3d %s\n", i+1, stepTitle(step))
+			continue
+		}
+		failed += 1
+		fmt.Printf("  FAIL  %3d %s\n", i+1, stepTitle(step))
+		for _, d := range diffs {
+			fmt.Println("              " + d)
+		}
+	}
+	fmt.Printf("%d steps, %d failed\n\n", len(scenario.Steps), failed)
+	return failed, nil
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		log.Fatal("usage: clientScenario [flags] scenario.json...")
+	}
+
+	config := &xoclient.Config{Encoding: *encoding}
+	if *useTls {
+		tlsConfig, err := xoclient.NewTLSConfig(*tlsCaFile, *tlsInsecure)
+		if err != nil {
+			log.Fatal(err)
+		}
+		config.TLS = tlsConfig
+	}
+
+	// Сервер помнит пользователей между запусками, так что имена в сценариях делаются уникальными через ${run}
+	runId := strconv.FormatInt(rand.New(rand.NewSource(time.Now().UnixNano())).Int63n(36*36*36*36), 36)
+	ctx := context.Background()
+	failed := 0
+	for i, path := range flag.Args() {
+		scenario, err := loadScenario(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		n, err := run(ctx, scenario, runId+strconv.Itoa(i), config)
+		if err != nil {
+			log.Printf("scenario %s: %v", scenario.Name, err)
+			failed += 1
+		}
+		failed += n
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
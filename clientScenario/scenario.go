@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Scenario - сценарий игры: кто что отправляет и что должен получить в ответ и в рассылках.
+//
+// В строках запросов и ожиданий ${name} заменяется на переменную: заданную в Vars,
+// захваченную из ответа (Capture) или встроенную ${run} - уникальную для запуска,
+// чтобы имена пользователей не совпадали с прошлыми запусками.
+//
+// Ожидание сравнивается с ответом так:
+//   - в объекте ответа должны быть все ключи ожидания, лишние ключи не важны;
+//   - строка "*" совпадает с любым значением;
+//   - массив совпадает поэлементно и по длине;
+//   - {"$unordered": [...]} - массив в любом порядке (например, игроки из map на сервере).
+type Scenario struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Actors      []string          `json:"actors"`
+	Vars        map[string]string `json:"vars"`
+	Steps       []*Step           `json:"steps"`
+}
+
+type Step struct {
+	Actor      string            `json:"actor"`
+	Sleep      float64           `json:"sleep"`      // seconds, пауза перед шагом
+	Send       json.RawMessage   `json:"send"`       // запрос как есть; без него шаг только ждет рассылки
+	Expect     json.RawMessage   `json:"expect"`     // ожидаемый ответ
+	Capture    map[string]string `json:"capture"`    // переменная -> путь в ответе через точку, например "token"
+	Broadcasts []json.RawMessage `json:"broadcasts"` // рассылки, которые актер должен получить по порядку
+	Timeout    float64           `json:"timeout"`    // seconds, ожидание каждой рассылки
+}
+
+func loadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	scenario := &Scenario{}
+	err = json.Unmarshal(data, scenario)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if scenario.Name == "" {
+		scenario.Name = path
+	}
+	actors := map[string]bool{}
+	for _, a := range scenario.Actors {
+		actors[a] = true
+	}
+	for i, step := range scenario.Steps {
+		if !actors[step.Actor] {
+			return nil, fmt.Errorf("%s: step %d: unknown actor %q", path, i+1, step.Actor)
+		}
+		if step.Send == nil && len(step.Broadcasts) == 0 {
+			return nil, fmt.Errorf("%s: step %d: nothing to send or wait for", path, i+1)
+		}
+	}
+	return scenario, nil
+}
+
+var varPattern = regexp.MustCompile(`\$\{([A-Za-z0-9_]+)\}`)
+
+// substitute подставляет переменные во все строки JSON
+func substitute(raw json.RawMessage, vars map[string]string) (any, error) {
+	var v any
+	err := json.Unmarshal(raw, &v)
+	if err != nil {
+		return nil, err
+	}
+	missing := []string{}
+	var walk func(v any) any
+	walk = func(v any) any {
+		switch x := v.(type) {
+		case string:
+			return varPattern.ReplaceAllStringFunc(x, func(m string) string {
+				name := varPattern.FindStringSubmatch(m)[1]
+				value, ok := vars[name]
+				if !ok {
+					missing = append(missing, name)
+				}
+				return value
+			})
+		case []any:
+			for i := range x {
+				x[i] = walk(x[i])
+			}
+		case map[string]any:
+			for k := range x {
+				x[k] = walk(x[k])
+			}
+		}
+		return v
+	}
+	v = walk(v)
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("undefined variables: %s", strings.Join(missing, ", "))
+	}
+	return v, nil
+}
+
+// match сравнивает ответ с ожиданием и возвращает список различий
+func match(path string, expected any, actual any) []string {
+	if s, ok := expected.(string); ok && s == "*" {
+		if actual == nil {
+			return []string{path + ": expected a value, got nothing"}
+		}
+		return nil
+	}
+
+	switch e := expected.(type) {
+	case map[string]any:
+		if unordered, ok := e["$unordered"]; ok && len(e) == 1 {
+			return matchUnordered(path, unordered, actual)
+		}
+		a, ok := actual.(map[string]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected an object, got %s", path, show(actual))}
+		}
+		diffs := []string{}
+		keys := []string{}
+		for k := range e {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			av, ok := a[k]
+			if !ok {
+				diffs = append(diffs, fmt.Sprintf("%s: missing, expected %s", join(path, k), show(e[k])))
+				continue
+			}
+			diffs = append(diffs, match(join(path, k), e[k], av)...)
+		}
+		return diffs
+	case []any:
+		a, ok := actual.([]any)
+		if !ok || len(a) != len(e) {
+			return []string{fmt.Sprintf("%s: expected %s, got %s", path, show(expected), show(actual))}
+		}
+		diffs := []string{}
+		for i := range e {
+			diffs = append(diffs, match(join(path, strconv.Itoa(i)), e[i], a[i])...)
+		}
+		return diffs
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		return []string{fmt.Sprintf("%s: expected %s, got %s", path, show(expected), show(actual))}
+	}
+	return nil
+}
+
+func matchUnordered(path string, expected any, actual any) []string {
+	e, ok := expected.([]any)
+	if !ok {
+		return []string{path + ": $unordered needs an array"}
+	}
+	a, ok := actual.([]any)
+	if !ok || len(a) != len(e) {
+		return []string{fmt.Sprintf("%s: expected %s in any order, got %s", path, show(expected), show(actual))}
+	}
+	used := make([]bool, len(a))
+	for _, ev := range e {
+		found := false
+		for i, av := range a {
+			if !used[i] && len(match(path, ev, av)) == 0 {
+				used[i] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return []string{fmt.Sprintf("%s: expected %s in any order, got %s", path, show(expected), show(actual))}
+		}
+	}
+	return nil
+}
+
+// lookup достает значение по пути через точку: "token", "usernames.0"
+func lookup(v any, path string) (any, bool) {
+	for _, part := range strings.Split(path, ".") {
+		switch x := v.(type) {
+		case map[string]any:
+			var ok bool
+			v, ok = x[part]
+			if !ok {
+				return nil, false
+			}
+		case []any:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(x) {
+				return nil, false
+			}
+			v = x[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func join(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func show(v any) string {
+	if v == nil {
+		return "nothing"
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
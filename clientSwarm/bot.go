@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"Xo-xo-touch/xoclient"
+)
+
+// Рассылки, которые сервер отправляет сразу в ответ на запрос игрока. По ним считается задержка доставки:
+// от отправки последнего такого запроса в комнате до получения рассылки.
+// Рассылки, которые идут после паузы сервера (newduelvotingstarted, newroundstarted, ...), не считаются.
+var lagTriggers = map[string]string{
+	"entergame":  xoclient.EventNewPlayer,
+	"saveanswer": xoclient.EventEveryoneAnswered,
+	"savevote":   xoclient.EventDuelVotingEnded,
+}
+
+// SimGame - одна комната из ботов
+type SimGame struct {
+	Mutex    *sync.Mutex
+	GameNum  int64
+	Triggers map[string]time.Time // рассылка -> когда отправлен последний запрос, который ее вызывает
+}
+
+func (g *SimGame) trigger(method string, at time.Time) {
+	message, ok := lagTriggers[method]
+	if !ok {
+		return
+	}
+	g.Mutex.Lock()
+	g.Triggers[message] = at
+	g.Mutex.Unlock()
+}
+
+func (g *SimGame) lag(message string, at time.Time) (time.Duration, bool) {
+	g.Mutex.Lock()
+	defer g.Mutex.Unlock()
+	sent, ok := g.Triggers[message]
+	if !ok {
+		return 0, false
+	}
+	return at.Sub(sent), true
+}
+
+type Bot struct {
+	Client    *xoclient.Client
+	Game      *SimGame
+	Stats     *Stats
+	Rand      *rand.Rand
+	Username  string
+	Questions map[string]bool // вопросы раунда, на которые отвечает бот
+	Events    chan xoclient.Event
+}
+
+func (b *Bot) think() {
+	d := *thinkMin
+	if *thinkMax > *thinkMin {
+		d += time.Duration(b.Rand.Int63n(int64(*thinkMax - *thinkMin)))
+	}
+	time.Sleep(d)
+}
+
+const maxRetriesConst = 5
+
+// do выполняет запрос и записывает его задержку или ошибку.
+// На ErrTooManyRequests бот, как настоящий клиент, ждет и повторяет, но каждый отказ виден в отчете.
+func (b *Bot) do(method string, f func() error) error {
+	for retry := 0; ; retry++ {
+		start := time.Now()
+		b.Game.trigger(method, start)
+		err := f()
+		b.Stats.Observe(method, time.Since(start), err)
+		statusErr := &xoclient.StatusError{}
+		if retry == maxRetriesConst || !errors.As(err, &statusErr) || statusErr.Status != xoclient.ErrTooManyRequests {
+			return err
+		}
+		b.think()
+	}
+}
+
+// forwardEvents замеряет задержку в момент получения, пока бот думает над предыдущей рассылкой
+func (b *Bot) forwardEvents() {
+	for event := range b.Client.Events() {
+		lag, ok := b.Game.lag(event.Message, time.Now())
+		if ok {
+			b.Stats.ObserveLag(event.Message, lag)
+		}
+		b.Events <- event
+	}
+	close(b.Events)
+}
+
+// join подключает бота, регистрирует и заводит в комнату
+func (b *Bot) join(ctx context.Context, config *xoclient.Config) error {
+	c, err := xoclient.Dial(ctx, *reqAddr, *brcastAddr, config)
+	if err != nil {
+		b.Stats.Observe("dial", 0, err)
+		return err
+	}
+	b.Client = c
+	go b.forwardEvents()
+
+	err = b.do("register", func() error {
+		_, err := c.Register(ctx, b.Username, "parol123")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return b.do("entergame", func() error {
+		_, err := c.EnterGame(ctx)
+		return err
+	})
+}
+
+func (b *Bot) answerQuestions(ctx context.Context) error {
+	for {
+		b.think()
+		question := &xoclient.ResponseQuestion{}
+		err := b.do("getquestion", func() (err error) {
+			question, err = b.Client.GetQuestion(ctx)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		b.Questions[question.Question] = true
+
+		b.think()
+		answer := &xoclient.ResponseAnswer{}
+		err = b.do("saveanswer", func() (err error) {
+			answer, err = b.Client.SaveAnswer(ctx, fmt.Sprintf("answer %d", b.Rand.Intn(1000)))
+			return err
+		})
+		if err != nil || answer.LastAnswer {
+			return err
+		}
+	}
+}
+
+func (b *Bot) vote(ctx context.Context) error {
+	b.think()
+	duel := &xoclient.ResponseDuel{}
+	err := b.do("getduel", func() (err error) {
+		duel, err = b.Client.GetDuel(ctx)
+		return err
+	})
+	if err != nil || b.Questions[duel.Question] {
+		return err
+	}
+	b.think()
+	return b.do("savevote", func() error {
+		return b.Client.SaveVote(ctx, b.Rand.Int63n(int64(len(duel.Answers))))
+	})
+}
+
+// play играет, пока игра не кончится. Ошибки запросов не прерывают игру - их видно в отчете.
+func (b *Bot) play(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-b.Events:
+			if !ok {
+				return io.ErrUnexpectedEOF
+			}
+			switch event.Message {
+			case xoclient.EventGameStarted, xoclient.EventNewRoundStarted:
+				b.Questions = map[string]bool{}
+				b.answerQuestions(ctx)
+			case xoclient.EventEveryoneAnswered, xoclient.EventNewDuelVotingStarted:
+				b.vote(ctx)
+			case xoclient.EventDuelVotingEnded:
+				b.do("getduelresult", func() error {
+					_, err := b.Client.GetDuelResult(ctx)
+					return err
+				})
+			case xoclient.EventRoundVotingEnded:
+				b.do("getroundresult", func() error {
+					_, err := b.Client.GetRoundResult(ctx)
+					return err
+				})
+			case xoclient.EventGameEnded:
+				return b.do("getgameresult", func() error {
+					_, err := b.Client.GetGameResult(ctx)
+					return err
+				})
+			}
+		}
+	}
+}
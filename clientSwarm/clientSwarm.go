@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"Xo-xo-touch/xoclient"
+)
+
+// Нагрузочный тест: N игр по M ботов одновременно. Боты думают случайное время между запросами.
+// Все боты ходят с одного адреса, так что лимиты сервера на ip (ratelimits.ip) стоит поднять.
+
+var (
+	reqAddr     = flag.String("req", "127.0.0.1:8081", "address of the request port")
+	brcastAddr  = flag.String("brcast", "127.0.0.1:8082", "address of the broadcast port")
+	useTls      = flag.Bool("tls", false, "connect over TLS")
+	tlsCaFile   = flag.String("tlsca", "", "CA certificate (pem) to verify the server, system CAs if empty")
+	tlsInsecure = flag.Bool("tlsinsecure", false, "do not verify the server certificate (self-signed, testing only)")
+	encoding    = flag.String("encoding", "json", "wire encoding to ask the server for: json, msgpack")
+	gamesCnt    = flag.Int64("games", 10, "games to play at the same time")
+	playersCnt  = flag.Int64("players", 5, "bots in a game, must match maxuserscnt of the server")
+	thinkMin    = flag.Duration("thinkmin", 200*time.Millisecond, "shortest pause of a bot before a request")
+	thinkMax    = flag.Duration("thinkmax", 1500*time.Millisecond, "longest pause of a bot before a request")
+	ramp        = flag.Duration("ramp", 0, "pause between starting games")
+	gameTimeout = flag.Duration("timeout", 10*time.Minute, "how long one game may last")
+	format      = flag.String("format", "text", "report format: text, json")
+	seed        = flag.Int64("seed", 0, "random seed, 0 - from the clock")
+)
+
+// lobby - игроки одной игры подключаются и входят в комнату подряд. Сервер связывает соединения
+// в пару и заполняет комнаты по порядку, так что иначе боты разных игр перемешаются.
+var lobby = &sync.Mutex{}
+
+func runGame(ctx context.Context, gameNum int64, runId string, config *xoclient.Config, stats *Stats) bool {
+	ctx, cancel := context.WithTimeout(ctx, *gameTimeout)
+	defer cancel()
+
+	game := &SimGame{Mutex: &sync.Mutex{}, GameNum: gameNum, Triggers: map[string]time.Time{}}
+	bots := []*Bot{}
+	defer func() {
+		for _, b := range bots {
+			if b.Client != nil {
+				b.Client.Close()
+			}
+		}
+	}()
+
+	lobby.Lock()
+	for i := int64(0); i < *playersCnt; i++ {
+		b := &Bot{
+			Game:      game,
+			Stats:     stats,
+			Rand:      rand.New(rand.NewSource(*seed + gameNum*1000 + i)),
+			Username:  "b" + runId + "g" + strconv.FormatInt(gameNum, 10) + "p" + strconv.FormatInt(i, 10),
+			Questions: map[string]bool{},
+			Events:    make(chan xoclient.Event, 256),
+		}
+		bots = append(bots, b)
+		err := b.join(ctx, config)
+		if err != nil {
+			lobby.Unlock()
+			log.Printf("game %d: bot %s did not join: %v", gameNum, b.Username, err)
+			return false
+		}
+	}
+	lobby.Unlock()
+
+	wg := &sync.WaitGroup{}
+	errs := make([]error, len(bots))
+	for i, b := range bots {
+		wg.Add(1)
+		go func(i int, b *Bot) {
+			defer wg.Done()
+			errs[i] = b.play(ctx)
+		}(i, b)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			log.Printf("game %d: bot %s: %v", gameNum, bots[i].Username, err)
+			return false
+		}
+	}
+	return true
+}
+
+func main() {
+	flag.Parse()
+	if *format != "text" && *format != "json" {
+		log.Fatalf("unknown format %q", *format)
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	// Имена ботов уникальны между запусками, а зарегистрированные пользователи сервер помнит
+	runId := strconv.FormatInt(rand.New(rand.NewSource(*seed)).Int63n(36*36*36*36), 36)
+
+	config := &xoclient.Config{Timeout: 30 * time.Second, Encoding: *encoding}
+	if *useTls {
+		tlsConfig, err := xoclient.NewTLSConfig(*tlsCaFile, *tlsInsecure)
+		if err != nil {
+			log.Fatal(err)
+		}
+		config.TLS = tlsConfig
+	}
+
+	stats := newStats()
+	ctx := context.Background()
+	start := time.Now()
+	wg := &sync.WaitGroup{}
+	for g := int64(0); g < *gamesCnt; g++ {
+		stats.Mutex.Lock()
+		stats.GamesStarted += 1
+		stats.Mutex.Unlock()
+		wg.Add(1)
+		go func(g int64) {
+			defer wg.Done()
+			stats.GameDone(runGame(ctx, g, runId, config, stats))
+		}(g)
+		time.Sleep(*ramp)
+	}
+	wg.Wait()
+
+	report := stats.Report(time.Since(start))
+	if *format == "json" {
+		err := report.WriteJSON(os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	fmt.Println()
+	report.WriteText(os.Stdout)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"Xo-xo-touch/xoclient"
+)
+
+// Stats собирает задержки и ошибки всех ботов
+type Stats struct {
+	Mutex          *sync.Mutex
+	Latency        map[string][]time.Duration  // method -> задержки удачных запросов
+	Errors         map[string]map[string]int64 // method -> причина -> сколько
+	Lag            map[string][]time.Duration  // рассылка -> задержка доставки
+	GamesStarted   int64
+	GamesCompleted int64
+	GamesFailed    int64
+}
+
+func newStats() *Stats {
+	return &Stats{
+		Mutex:   &sync.Mutex{},
+		Latency: map[string][]time.Duration{},
+		Errors:  map[string]map[string]int64{},
+		Lag:     map[string][]time.Duration{},
+	}
+}
+
+// errorReason - короткая причина ошибки для отчета
+func errorReason(err error) string {
+	statusErr := &xoclient.StatusError{}
+	switch {
+	case errors.As(err, &statusErr):
+		return "status " + strconv.FormatInt(statusErr.Status, 10) + " " + statusErr.Code
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return "timeout"
+	case errors.Is(err, xoclient.ErrBroken):
+		return "broken connection"
+	case errors.Is(err, io.EOF):
+		return "connection closed"
+	}
+	return "network"
+}
+
+func (s *Stats) Observe(method string, latency time.Duration, err error) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	if err == nil {
+		s.Latency[method] = append(s.Latency[method], latency)
+		return
+	}
+	if s.Errors[method] == nil {
+		s.Errors[method] = map[string]int64{}
+	}
+	s.Errors[method][errorReason(err)] += 1
+}
+
+func (s *Stats) ObserveLag(message string, lag time.Duration) {
+	s.Mutex.Lock()
+	s.Lag[message] = append(s.Lag[message], lag)
+	s.Mutex.Unlock()
+}
+
+func (s *Stats) GameDone(completed bool) {
+	s.Mutex.Lock()
+	if completed {
+		s.GamesCompleted += 1
+	} else {
+		s.GamesFailed += 1
+	}
+	s.Mutex.Unlock()
+}
+
+// Percentiles - задержки в миллисекундах
+type Percentiles struct {
+	Count int64   `json:"count"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+}
+
+func percentiles(ds []time.Duration) Percentiles {
+	sorted := append([]time.Duration{}, ds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	p := Percentiles{Count: int64(len(sorted))}
+	if len(sorted) == 0 {
+		return p
+	}
+	at := func(q float64) float64 {
+		i := int(q*float64(len(sorted))+0.999999) - 1
+		if i < 0 {
+			i = 0
+		}
+		return float64(sorted[i]) / float64(time.Millisecond)
+	}
+	p.P50 = at(0.50)
+	p.P90 = at(0.90)
+	p.P99 = at(0.99)
+	p.Max = float64(sorted[len(sorted)-1]) / float64(time.Millisecond)
+	return p
+}
+
+type MethodReport struct {
+	Percentiles
+	Errors map[string]int64 `json:"errors,omitempty"`
+}
+
+type Report struct {
+	Duration       float64                  `json:"duration"` // seconds
+	GamesStarted   int64                    `json:"gamesstarted"`
+	GamesCompleted int64                    `json:"gamescompleted"`
+	GamesFailed    int64                    `json:"gamesfailed"`
+	Methods        map[string]*MethodReport `json:"methods"`
+	BroadcastLag   map[string]Percentiles   `json:"broadcastlag"`
+}
+
+func (s *Stats) Report(duration time.Duration) *Report {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	r := &Report{
+		Duration:       duration.Seconds(),
+		GamesStarted:   s.GamesStarted,
+		GamesCompleted: s.GamesCompleted,
+		GamesFailed:    s.GamesFailed,
+		Methods:        map[string]*MethodReport{},
+		BroadcastLag:   map[string]Percentiles{},
+	}
+	for method, ds := range s.Latency {
+		r.Methods[method] = &MethodReport{Percentiles: percentiles(ds)}
+	}
+	for method, errs := range s.Errors {
+		if r.Methods[method] == nil {
+			r.Methods[method] = &MethodReport{}
+		}
+		r.Methods[method].Errors = errs
+	}
+	for message, ds := range s.Lag {
+		r.BroadcastLag[message] = percentiles(ds)
+	}
+	return r
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+func (r *Report) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "games: %d started, %d completed, %d failed in %.1fs\n\n",
+		r.GamesStarted, r.GamesCompleted, r.GamesFailed, r.Duration)
+
+	fmt.Fprintf(w, "%-16s %7s %7s %9s %9s %9s %9s\n", "method", "ok", "errors", "p50 ms", "p90 ms", "p99 ms", "max ms")
+	for _, method := range sortedKeys(r.Methods) {
+		m := r.Methods[method]
+		errs := int64(0)
+		for _, n := range m.Errors {
+			errs += n
+		}
+		fmt.Fprintf(w, "%-16s %7d %7d %9.1f %9.1f %9.1f %9.1f\n", method, m.Count, errs, m.P50, m.P90, m.P99, m.Max)
+	}
+
+	hasErrors := false
+	for _, method := range sortedKeys(r.Methods) {
+		for _, reason := range sortedKeys(r.Methods[method].Errors) {
+			if !hasErrors {
+				fmt.Fprintf(w, "\nerrors:\n")
+				hasErrors = true
+			}
+			fmt.Fprintf(w, "  %-16s %-20s %d\n", method, reason, r.Methods[method].Errors[reason])
+		}
+	}
+
+	fmt.Fprintf(w, "\n%-22s %7s %9s %9s %9s %9s\n", "broadcast lag", "count", "p50 ms", "p90 ms", "p99 ms", "max ms")
+	for _, message := range sortedKeys(r.BroadcastLag) {
+		l := r.BroadcastLag[message]
+		fmt.Fprintf(w, "%-22s %7d %9.1f %9.1f %9.1f %9.1f\n", message, l.Count, l.P50, l.P90, l.P99, l.Max)
+	}
+}
@@ -0,0 +1,513 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"Xo-xo-touch/xoclient"
+)
+
+// Терминальный клиент: один игрок, живой экран. Рассылки читаются в своей горутине,
+// ввод - в своей, а main по ним ведет игру.
+
+var (
+	reqAddr     = flag.String("req", "127.0.0.1:8081", "address of the request port")
+	brcastAddr  = flag.String("brcast", "127.0.0.1:8082", "address of the broadcast port")
+	useTls      = flag.Bool("tls", false, "connect over TLS")
+	tlsCaFile   = flag.String("tlsca", "", "CA certificate (pem) to verify the server, system CAs if empty")
+	tlsInsecure = flag.Bool("tlsinsecure", false, "do not verify the server certificate (self-signed, testing only)")
+	encoding    = flag.String("encoding", "json", "wire encoding to ask the server for: json, msgpack")
+	username    = flag.String("user", "", "username, asked if empty")
+	password    = flag.String("password", "", "password, asked if empty")
+)
+
+// Screen печатает сообщения так, чтобы приглашение к вводу оставалось последней строкой
+type Screen struct {
+	Mutex  *sync.Mutex
+	Prompt string
+}
+
+func (s *Screen) Println(a ...any) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	if s.Prompt != "" {
+		fmt.Print("\r\033[K")
+	}
+	fmt.Println(a...)
+	fmt.Print(s.Prompt)
+}
+
+func (s *Screen) SetPrompt(prompt string) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	s.Prompt = prompt
+	fmt.Print(prompt)
+}
+
+// Чего игра ждет от ввода
+type Expect int
+
+const (
+	ExpectNothing Expect = iota
+	ExpectAnswer
+	ExpectVote
+	ExpectRematch
+)
+
+type Player struct {
+	Client    *xoclient.Client
+	Screen    *Screen
+	Username  string
+	Expect    Expect
+	Questions map[string]bool // вопросы этого раунда, на которые отвечает игрок
+	DuelNum   int64
+	RoundNum  int64
+	Prompts   int64 // сколько своих вопросов прислал игрок
+	Options   int64 // сколько вариантов в дуэли, за которую голосует игрок
+}
+
+func readLines(lines chan<- string) {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		lines <- strings.TrimSpace(scanner.Text())
+	}
+	close(lines)
+}
+
+// readEvents показывает рассылки сразу, а те, от которых зависит ход игры, передает в main
+func readEvents(c *xoclient.Client, screen *Screen, gameEvents chan<- xoclient.Event) {
+	for event := range c.Events() {
+		switch event.Message {
+		case xoclient.EventNewPlayer:
+			screen.Println("+ " + event.Username + " joined the room")
+		case xoclient.EventChat:
+			screen.Println("[" + event.Username + "] " + event.Text)
+		case xoclient.EventReaction:
+			screen.Println(event.Username + " reacts " + event.Emoji)
+		case xoclient.EventPlayAgain:
+			if event.Accept {
+				screen.Println(event.Username + " wants a rematch")
+			} else {
+				screen.Println(event.Username + " does not want a rematch")
+			}
+		case xoclient.EventNewHost:
+			screen.Println("* " + event.Username + " is the host now")
+		case xoclient.EventGamePaused:
+			screen.Println("|| " + event.Username + " paused the game")
+		case xoclient.EventGameResumed:
+			screen.Println("> " + event.Username + " resumed the game")
+		case xoclient.EventRoomSettings:
+			screen.Println(fmt.Sprintf("* room settings: %s, %d players, %d rounds, %d prompts each, %d teams", event.Mode, event.MaxUsers, event.MaxRounds, event.Prompts, event.Teams))
+		case xoclient.EventTeamChanged:
+			screen.Println("* " + event.Username + " joined team " + event.Team)
+		case xoclient.EventTeams:
+			teams := []string{}
+			for team := range event.Members {
+				teams = append(teams, team)
+			}
+			sort.Strings(teams)
+			for _, team := range teams {
+				screen.Println("team " + team + ": " + strings.Join(event.Members[team], ", "))
+			}
+		case xoclient.EventServerShuttingDown:
+			screen.Println(fmt.Sprintf("! server is shutting down, the game has %.0f seconds to finish", event.Grace))
+		default:
+			gameEvents <- event
+		}
+	}
+	close(gameEvents)
+}
+
+func ask(lines <-chan string, screen *Screen, prompt string) (string, bool) {
+	screen.SetPrompt(prompt)
+	line, ok := <-lines
+	screen.SetPrompt("")
+	return line, ok
+}
+
+// login входит под пользователем, а если его нет - регистрирует
+func login(ctx context.Context, c *xoclient.Client, lines <-chan string, screen *Screen) (string, error) {
+	user := *username
+	pass := *password
+	if user == "" {
+		user, _ = ask(lines, screen, "username: ")
+	}
+	if pass == "" {
+		pass, _ = ask(lines, screen, "password: ")
+	}
+
+	_, err := c.Login(ctx, user, pass)
+	if xoclient.ErrorCode(err) == xoclient.CodeWrongCredentials {
+		screen.Println("no such user, registering " + user)
+		_, err = c.Register(ctx, user, pass)
+	}
+	return user, err
+}
+
+func (p *Player) printPlayers(title string, usernames []string) {
+	if len(usernames) == 0 {
+		p.Screen.Println(title + ": nobody yet")
+		return
+	}
+	p.Screen.Println(title + ": " + strings.Join(usernames, ", "))
+}
+
+func (p *Player) printPoints(title string, points map[string]int64) {
+	usernames := []string{}
+	for u := range points {
+		usernames = append(usernames, u)
+	}
+	sort.Slice(usernames, func(i, j int) bool { return points[usernames[i]] > points[usernames[j]] })
+	p.Screen.Println("== " + title + " ==")
+	for i, u := range usernames {
+		me := ""
+		if u == p.Username {
+			me = " (you)"
+		}
+		p.Screen.Println(fmt.Sprintf("%d. %s%s - %d", i+1, u, me, points[u]))
+	}
+}
+
+// nextQuestion показывает следующий вопрос игрока
+func (p *Player) nextQuestion(ctx context.Context) {
+	question, err := p.Client.GetQuestion(ctx)
+	if err != nil {
+		p.Screen.Println("! getquestion: " + err.Error())
+		return
+	}
+	p.Questions[question.Question] = true
+	p.Expect = ExpectAnswer
+	p.Screen.Println("Q: " + question.Question)
+	p.Screen.SetPrompt("your answer> ")
+}
+
+func (p *Player) answer(ctx context.Context, line string) {
+	res, err := p.Client.SaveAnswer(ctx, line)
+	if err != nil {
+		p.Screen.Println("! saveanswer: " + err.Error())
+		return
+	}
+	p.Screen.SetPrompt("")
+	p.Expect = ExpectNothing
+	if res.LastAnswer {
+		p.Screen.Println("waiting for the others to answer...")
+		return
+	}
+	p.nextQuestion(ctx)
+}
+
+// showDuel показывает текущую дуэль и, если игрок в ней не участвует, просит проголосовать
+func (p *Player) showDuel(ctx context.Context) {
+	duel, err := p.Client.GetDuel(ctx)
+	if err != nil {
+		p.Screen.Println("! getduel: " + err.Error())
+		return
+	}
+	p.DuelNum += 1
+	p.Screen.Println(fmt.Sprintf("-- duel %d: %s", p.DuelNum, duel.Question))
+	for i, a := range duel.Answers {
+		p.Screen.Println(fmt.Sprintf("  %d) %s", i+1, a))
+	}
+	if p.Questions[duel.Question] {
+		p.Screen.Println("one of these is yours, the others are voting")
+		return
+	}
+	p.Options = int64(len(duel.Answers))
+	p.Expect = ExpectVote
+	p.Screen.SetPrompt(fmt.Sprintf("vote 1 to %d> ", p.Options))
+}
+
+func (p *Player) vote(ctx context.Context, line string) {
+	n, err := strconv.ParseInt(line, 10, 64)
+	if err != nil || n < 1 || n > p.Options {
+		p.Screen.Println(fmt.Sprintf("type a number from 1 to %d", p.Options))
+		return
+	}
+	err = p.Client.SaveVote(ctx, n-1)
+	p.Screen.SetPrompt("")
+	p.Expect = ExpectNothing
+	if err != nil {
+		p.Screen.Println("! savevote: " + err.Error())
+		return
+	}
+	p.Screen.Println("vote saved")
+}
+
+func (p *Player) showDuelResult(ctx context.Context) {
+	res, err := p.Client.GetDuelResult(ctx)
+	if err != nil {
+		p.Screen.Println("! getduelresult: " + err.Error())
+		return
+	}
+	if res.Author != "" {
+		p.Screen.Println("  prompt by " + res.Author)
+	}
+	votes := [][]string{res.VotesFor0, res.VotesFor1}
+	for i := range res.Answers {
+		p.Screen.Println(fmt.Sprintf("  %s: %q - %d votes %v", res.Usernames[i], res.Answers[i], len(votes[i]), votes[i]))
+	}
+	if res.Truth != "" {
+		p.Screen.Println(fmt.Sprintf("  the truth: %q - found by %d %v", res.Truth, len(res.VotesForTruth), res.VotesForTruth))
+	}
+}
+
+// handleEvent ведет игру по рассылкам. Возвращает false, когда игра кончилась.
+func (p *Player) handleEvent(ctx context.Context, event xoclient.Event) bool {
+	switch event.Message {
+	case xoclient.EventGameStarted, xoclient.EventNewRoundStarted:
+		p.RoundNum += 1
+		p.DuelNum = 0
+		p.Questions = map[string]bool{}
+		p.Screen.Println(fmt.Sprintf("=== round %d ===", p.RoundNum))
+		p.nextQuestion(ctx)
+	case xoclient.EventEveryoneAnswered, xoclient.EventNewDuelVotingStarted:
+		p.showDuel(ctx)
+	case xoclient.EventDuelVotingEnded:
+		p.Screen.SetPrompt("")
+		p.Expect = ExpectNothing
+		p.showDuelResult(ctx)
+	case xoclient.EventRoundVotingEnded:
+		res, err := p.Client.GetRoundResult(ctx)
+		if err != nil {
+			p.Screen.Println("! getroundresult: " + err.Error())
+			break
+		}
+		p.printPoints(fmt.Sprintf("round %d", p.RoundNum), res.Points)
+		if len(res.Teams) > 0 {
+			p.printPoints("teams", res.Teams)
+		}
+	case xoclient.EventGameEnded:
+		res, err := p.Client.GetGameResult(ctx)
+		if err != nil {
+			p.Screen.Println("! getgameresult: " + err.Error())
+			return false
+		}
+		p.printPoints("game over", res.Points)
+		if len(res.Teams) > 0 {
+			p.printPoints("teams", res.Teams)
+		}
+		if p.Prompts > 0 {
+			pack, err := p.Client.SavePrompts(ctx)
+			if err != nil {
+				p.Screen.Println("! saveprompts: " + err.Error())
+				return false
+			}
+			p.Screen.Println(fmt.Sprintf("your prompts are saved, %d in your pack", len(pack.Prompts)))
+		}
+		if !p.Client.Server().HasFeature("rematch") {
+			return false
+		}
+		p.Expect = ExpectRematch
+		p.Screen.SetPrompt("play again with the same group? y/n> ")
+	case xoclient.EventRematch:
+		p.RoundNum = 0
+		p.Prompts = 0
+		p.printPlayers("rematch", event.Usernames)
+		p.Screen.Println("the game starts soon...")
+	case xoclient.EventKicked:
+		if event.Username == p.Username {
+			p.Screen.Println("you were kicked from the room")
+			return false
+		}
+		p.Screen.Println("- " + event.Username + " was kicked")
+	case xoclient.EventRematchCancelled:
+		p.Screen.SetPrompt("")
+		p.Screen.Println("not enough players want a rematch")
+		return false
+	}
+	return true
+}
+
+// playAgain голосует за реванш. Возвращает false, если игрок уходит.
+func (p *Player) playAgain(ctx context.Context, line string) bool {
+	if line != "y" && line != "n" {
+		p.Screen.Println("type y or n")
+		return true
+	}
+	p.Screen.SetPrompt("")
+	p.Expect = ExpectNothing
+	err := p.Client.PlayAgain(ctx, line == "y")
+	if err != nil {
+		p.Screen.Println("! playagain: " + err.Error())
+		return false
+	}
+	if line == "n" {
+		return false
+	}
+	p.Screen.Println("waiting for the others to decide...")
+	return true
+}
+
+// setRoom меняет настройки комнаты: /set players=4 rounds=2 prompts=1 teams=2 mode=bluff
+func (p *Player) setRoom(ctx context.Context, args []string) {
+	settings := xoclient.RoomSettings{}
+	for _, arg := range args {
+		name, value, _ := strings.Cut(arg, "=")
+		if name == "mode" {
+			settings.Mode = value
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			p.Screen.Println("usage: /set players=N rounds=N prompts=N teams=N mode=classic|bluff")
+			return
+		}
+		switch name {
+		case "players":
+			settings.MaxUsers = &n
+		case "rounds":
+			settings.MaxRounds = &n
+		case "prompts":
+			settings.Prompts = &n
+		case "teams":
+			settings.Teams = &n
+		default:
+			p.Screen.Println("usage: /set players=N rounds=N prompts=N teams=N mode=classic|bluff")
+			return
+		}
+	}
+	err := p.Client.SetRoomSettings(ctx, settings)
+	if err != nil {
+		p.Screen.Println("! roomsettings: " + err.Error())
+	}
+}
+
+// handleLine обрабатывает строку игрока. Возвращает false, если игрок уходит.
+func (p *Player) handleLine(ctx context.Context, line string) bool {
+	switch {
+	case line == "":
+	// Пауза нужна и посреди ответа или голосования
+	case line == "/pause":
+		err := p.Client.PauseGame(ctx)
+		if err != nil {
+			p.Screen.Println("! pausegame: " + err.Error())
+		}
+	case line == "/resume":
+		err := p.Client.ResumeGame(ctx)
+		if err != nil {
+			p.Screen.Println("! resumegame: " + err.Error())
+		}
+	case p.Expect == ExpectRematch:
+		return p.playAgain(ctx, line)
+	case p.Expect == ExpectAnswer:
+		p.answer(ctx, line)
+	case p.Expect == ExpectVote:
+		p.vote(ctx, line)
+	case strings.HasPrefix(line, "/kick "):
+		err := p.Client.Kick(ctx, strings.TrimPrefix(line, "/kick "))
+		if err != nil {
+			p.Screen.Println("! kick: " + err.Error())
+		}
+	case line == "/start":
+		err := p.Client.StartGame(ctx)
+		if err != nil {
+			p.Screen.Println("! startgame: " + err.Error())
+		}
+	case strings.HasPrefix(line, "/set "):
+		p.setRoom(ctx, strings.Fields(strings.TrimPrefix(line, "/set ")))
+	case strings.HasPrefix(line, "/team "):
+		err := p.Client.JoinTeam(ctx, strings.TrimPrefix(line, "/team "))
+		if err != nil {
+			p.Screen.Println("! jointeam: " + err.Error())
+		}
+	case strings.HasPrefix(line, "/prompt "):
+		err := p.Client.SubmitPrompt(ctx, strings.TrimPrefix(line, "/prompt "))
+		if err != nil {
+			p.Screen.Println("! submitprompt: " + err.Error())
+			break
+		}
+		p.Prompts += 1
+		p.Screen.Println("prompt sent")
+	default:
+		// Все остальное уходит в чат комнаты
+		err := p.Client.SendChat(ctx, line)
+		if err != nil {
+			p.Screen.Println("! sendchat: " + err.Error())
+		}
+	}
+	return true
+}
+
+func main() {
+	flag.Parse()
+	ctx := context.Background()
+
+	config := &xoclient.Config{Encoding: *encoding}
+	if *useTls {
+		tlsConfig, err := xoclient.NewTLSConfig(*tlsCaFile, *tlsInsecure)
+		if err != nil {
+			log.Fatal(err)
+		}
+		config.TLS = tlsConfig
+	}
+	c, err := xoclient.Dial(ctx, *reqAddr, *brcastAddr, config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	screen := &Screen{Mutex: &sync.Mutex{}}
+	lines := make(chan string)
+	go readLines(lines)
+	server := c.Server()
+	screen.Println(fmt.Sprintf("server %s, protocol %d, features %v, encoding %s", server.Server, server.Version, server.Features, server.Encoding))
+
+	user, err := login(ctx, c, lines, screen)
+	if err != nil {
+		log.Fatal(err)
+	}
+	screen.Println("logged in as " + user + ". Type /quit to leave; lines typed while nothing is asked go to the room chat.")
+
+	gameEvents := make(chan xoclient.Event, xoclient.DefaultEventBuffer)
+	go readEvents(c, screen, gameEvents)
+
+	players, err := c.EnterGame(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p := &Player{Client: c, Screen: screen, Username: user, Questions: map[string]bool{}}
+	p.printPlayers("in the room", players.Usernames)
+	if players.Host == user {
+		p.Screen.Println("you are the host: /set players=N rounds=N prompts=N teams=N mode=classic|bluff, /kick <name>, /start to begin without waiting, /pause and /resume during the game")
+	} else if players.Host != "" {
+		p.Screen.Println("host: " + players.Host)
+	}
+	if players.Mode == "bluff" {
+		p.Screen.Println("bluff: make up fake answers that look true, then find the true answer among the fakes")
+	}
+	if len(players.Teams) > 0 {
+		p.Screen.Println("a team game, pick a team or get one when the game starts: /team " + strings.Join(players.Teams, "|"))
+	}
+	if players.Prompts > 0 {
+		p.Screen.Println(fmt.Sprintf("send up to %d prompts of your own while waiting: /prompt <text>", players.Prompts))
+	}
+	screen.Println("waiting for the room to fill up...")
+
+	for {
+		select {
+		case event, ok := <-gameEvents:
+			if !ok {
+				screen.Println("connection closed")
+				return
+			}
+			if !p.handleEvent(ctx, event) {
+				return
+			}
+		case line, ok := <-lines:
+			if !ok || line == "/quit" {
+				return
+			}
+			if !p.handleLine(ctx, line) {
+				return
+			}
+		}
+	}
+}
@@ -1,119 +1,135 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
+	"context"
+	"flag"
 	"log"
-	"net"
 	"strconv"
 	"time"
+
+	"Xo-xo-touch/xoclient"
 )
 import "fmt"
 
-type ResToken struct {
-	Token string `json:"token"`
-}
-
 func catch(err error) {
 	if err != nil {
 		log.Println(err)
 	}
 }
 
+var (
+	reqAddr     = flag.String("req", "6.tcp.eu.ngrok.io:16581", "address of the request port")
+	brcastAddr  = flag.String("brcast", "4.tcp.eu.ngrok.io:10138", "address of the broadcast port")
+	useTls      = flag.Bool("tls", false, "connect over TLS")
+	tlsCaFile   = flag.String("tlsca", "", "CA certificate (pem) to verify the server, system CAs if empty")
+	tlsInsecure = flag.Bool("tlsinsecure", false, "do not verify the server certificate (self-signed, testing only)")
+)
+
 const sleepConst = 100
 const sleepBetweenConst = 5
 
-func printRequest(conn net.Conn, reqType string) {
-	res, err := bufio.NewReader(conn).ReadString('}')
-	catch(err)
-	fmt.Println("Request (" + reqType + "): " + res)
+func printResponse(reqType string, res any, err error) {
+	if err != nil {
+		fmt.Println("Request (" + reqType + "): " + err.Error())
+	} else {
+		fmt.Printf("Request (%s): %+v\n", reqType, res)
+	}
 	time.Sleep(sleepConst * time.Millisecond)
 }
 
-func printBroadcast(conn2 net.Conn) {
-	res2, err := bufio.NewReader(conn2).ReadString('}')
-	catch(err)
-	fmt.Println("\nBroadcast: " + res2 + "\n")
-	//time.Sleep(sleepConst * time.Millisecond)
+func printBroadcasts(c *xoclient.Client) {
+	for event := range c.Events() {
+		fmt.Println("\nBroadcast: " + string(event.Raw) + "\n")
+	}
 }
 
-func registerAndEntergame(conn net.Conn, conn2 net.Conn, usernames []string) []string {
+func registerAndEntergame(ctx context.Context, c *xoclient.Client, usernames []string) []string {
 	tokens := []string{}
 	for _, u := range usernames {
 		// Register
-		fmt.Fprintf(conn, "{\"method\": \"register\", \"username\": \""+u+"\", \"password\": \"parol123\"}\n")
-		res, err := bufio.NewReader(conn).ReadString('}')
+		res, err := c.Register(ctx, u, "parol123")
 		catch(err)
 		fmt.Println("Request (register): ...")
 		time.Sleep(sleepConst * time.Millisecond)
-		resToken := ResToken{}
-		err = json.Unmarshal([]byte(res), &resToken)
-		catch(err)
-		token := resToken.Token
-		tokens = append(tokens, token)
+		if err != nil {
+			continue
+		}
+		tokens = append(tokens, res.Token)
 
 		// Entergame
-		fmt.Fprintf(conn, "{\"method\": \"entergame\", \"token\": \""+token+"\"}\n")
-		printRequest(conn, "entergame")
+		players, err := c.EnterGame(ctx)
+		printResponse("entergame", players, err)
 		time.Sleep(2 * time.Second)
-
-		go printBroadcast(conn2)
 	}
 	return tokens
 }
 
-func saveAnswers(conn net.Conn, conn2 net.Conn, tokens []string) {
+func saveAnswers(ctx context.Context, c *xoclient.Client, tokens []string) {
 	for qn := range []int{0, 1} {
 		for i, t := range tokens {
+			c.SetToken(t)
+
 			// Get question
-			fmt.Fprintf(conn, "{\"method\": \"getquestion\", \"token\": \""+t+"\"}\n")
-			printRequest(conn, "getquestion")
+			question, err := c.GetQuestion(ctx)
+			printResponse("getquestion", question, err)
 
 			// Save answer
-			fmt.Fprintf(conn, "{\"method\": \"saveanswer\", \"token\": \""+t+"\", \"answer\": \"ans "+strconv.Itoa(qn)+"."+strconv.Itoa(i)+"!\"}\n")
-			printRequest(conn, "saveanswer")
-
-			go printBroadcast(conn2)
+			answer, err := c.SaveAnswer(ctx, "ans "+strconv.Itoa(qn)+"."+strconv.Itoa(i)+"!")
+			printResponse("saveanswer", answer, err)
 		}
 	}
 }
 
-func sendVotes(conn net.Conn, conn2 net.Conn, tokens []string) {
+func sendVotes(ctx context.Context, c *xoclient.Client, tokens []string) {
 
 	for i, t := range tokens {
 		fmt.Println("----- Voting:", i)
+		c.SetToken(t)
+
 		// Get duel
-		fmt.Fprintf(conn, "{\"method\": \"getduel\", \"token\": \""+t+"\"}\n")
-		printRequest(conn, "getduel")
+		duel, err := c.GetDuel(ctx)
+		printResponse("getduel", duel, err)
 
 		// Save vote
-		fmt.Fprintf(conn, "{\"method\": \"savevote\", \"vote\": 1, \"token\": \""+t+"\"}\n")
-		printRequest(conn, "savevote")
-
-		go printBroadcast(conn2)
+		err = c.SaveVote(ctx, 1)
+		printResponse("savevote", "ok", err)
 	}
 }
 
 func main() {
+	flag.Parse()
+	ctx := context.Background()
+
 	// Подключаемся к сокету
 	fmt.Println("Start client")
-	connReq, err := net.Dial("tcp", "6.tcp.eu.ngrok.io:16581")
-	catch(err)
-	connBrcast, err := net.Dial("tcp", "4.tcp.eu.ngrok.io:10138")
-	catch(err)
-	fmt.Println("CONNS:", connReq, connBrcast)
+	config := &xoclient.Config{}
+	if *useTls {
+		tlsConfig, err := xoclient.NewTLSConfig(*tlsCaFile, *tlsInsecure)
+		if err != nil {
+			log.Fatal(err)
+		}
+		config.TLS = tlsConfig
+	}
+	c, err := xoclient.Dial(ctx, *reqAddr, *brcastAddr, config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+	fmt.Println("CONNS:", c.ConnReq.RemoteAddr(), c.ConnBrcast.RemoteAddr())
+	go printBroadcasts(c)
 
-	tokens := registerAndEntergame(connReq, connBrcast, []string{"dovolniy", "Yuriy", "Posevin", "user4"})
+	tokens := registerAndEntergame(ctx, c, []string{"dovolniy", "Yuriy", "Posevin", "user4"})
 	time.Sleep(20 * time.Second)
 
-	saveAnswers(connReq, connBrcast, tokens)
+	saveAnswers(ctx, c, tokens)
 	time.Sleep(20 * time.Second)
 
-	sendVotes(connReq, connBrcast, tokens)
+	sendVotes(ctx, c, tokens)
 	time.Sleep(20 * time.Second)
 
-	fmt.Fprint(connReq, "{\"method\": \"getroundresult\", \"token\": \""+tokens[0]+"\"}\n")
-	printRequest(connReq, "getroundresult")
-	printBroadcast(connBrcast)
+	c.SetToken(tokens[0])
+	result, err := c.GetRoundResult(ctx)
+	printResponse("getroundresult", result, err)
+	time.Sleep(sleepBetweenConst * time.Second)
 
 }
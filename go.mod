@@ -6,4 +6,5 @@ require github.com/google/uuid v1.3.1
 
 require (
 	github.com/golang-jwt/jwt v3.2.2+incompatible
+	golang.org/x/crypto v0.21.0
 )
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"Xo-xo-touch/xoserver"
+)
+
+// Задаются при сборке: go build -ldflags "-X main.version=1.2.3 -X main.commit=abc123"
+var (
+	version = "dev"
+	commit  = ""
+)
+
+func main() {
+	loader, err := xoserver.NewConfigLoader(os.Args[1:])
+	if err != nil {
+		slog.Error("parse flags", "err", err)
+		os.Exit(2)
+	}
+	config, err := loader.Load()
+	if err != nil {
+		slog.Error("load config", "err", err)
+		os.Exit(1)
+	}
+	// Формат логов меняется только перезапуском, уровень - и по SIGHUP
+	slog.SetDefault(xoserver.NewLogger(os.Stdout, config.LogFormat))
+	slog.Info("start", "portreq", config.PortReq, "portbrcast", config.PortBrcast, "version", version)
+	xoserver.Version = version
+	xoserver.Commit = commit
+
+	srv, err := xoserver.New(config)
+	if err != nil {
+		slog.Error("load state", "file", config.StateFile, "err", err)
+		os.Exit(1)
+	}
+	err = srv.Start()
+	if err != nil {
+		slog.Error("listen", "err", err)
+		os.Exit(1)
+	}
+
+	// По SIGHUP перечитать настройки
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			config, err := loader.Load()
+			if err != nil {
+				slog.Error("config is not reloaded", "err", err)
+				continue
+			}
+			srv.Reload(config)
+			slog.Info("config reloaded")
+		}
+	}()
+
+	// По SIGTERM и SIGINT доиграть идущие игры и остановиться
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	<-ctx.Done()
+	stop()
+
+	srv.Shutdown(time.Duration(srv.Config().ShutdownGrace * float64(time.Second)))
+}
@@ -0,0 +1,519 @@
+// Package xoclient - клиент для сервера Xo-xo-touch.
+//
+// Сервер слушает два порта: на один клиент шлет запросы и получает ответы,
+// с другого приходят рассылки игры (Events). В протоколе у запроса нет id,
+// поэтому Client отправляет запросы по одному и ждет ответа на каждый.
+package xoclient
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"Xo-xo-touch/xocodec"
+)
+
+const (
+	DefaultTimeout     = 10 * time.Second
+	DefaultEventBuffer = 64
+
+	// ProtocolVersion - версия протокола, на которой говорит клиент (см. Hello)
+	ProtocolVersion = 2
+
+	maxFrameLen = 1 << 20 // ответ или рассылка длиннее - ошибка, а не попытка съесть всю память
+)
+
+// ErrBroken - запрос был прерван на середине, и ответ на него может прийти в ответ на следующий.
+// Такое соединение больше не используется, нужно подключиться заново.
+var ErrBroken = errors.New("xoclient: connection is broken by an interrupted request")
+
+// StatusError - сервер ответил статусом, отличным от StatusOk.
+// Code - один из Code*, по нему и стоит решать, что делать; Message - для человека.
+type StatusError struct {
+	Method  string `json:"method"`
+	Status  int64  `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Field   string `json:"field"` // поле запроса, если ошибка в нем
+}
+
+func (e *StatusError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("xoclient: %s: status %d", e.Method, e.Status)
+	}
+	return fmt.Sprintf("xoclient: %s: %s (%d): %s", e.Method, e.Code, e.Status, e.Message)
+}
+
+// ErrorCode - код ошибки сервера из err или "", если это не ответ сервера
+func ErrorCode(err error) string {
+	statusErr := &StatusError{}
+	if errors.As(err, &statusErr) {
+		return statusErr.Code
+	}
+	return ""
+}
+
+type Config struct {
+	TLS          *tls.Config   // nil - обычный TCP
+	Timeout      time.Duration // на один запрос, если в контексте нет своего срока; 0 - DefaultTimeout
+	EventBuffer  int           // 0 - DefaultEventBuffer
+	Capabilities []string      // сообщаются серверу в hello
+	NoHello      bool          // Dial не шлет hello, например чтобы проверить, как сервер принимает старых клиентов
+	Encoding     string        // "msgpack" - попросить сервер о MessagePack в hello; "" или "json" - JSON
+}
+
+type Client struct {
+	Mutex      *sync.Mutex // держится на время запроса вместе с ответом
+	ConnReq    net.Conn
+	ConnBrcast net.Conn
+	Timeout    time.Duration
+
+	reader       *bufio.Reader
+	codec        xocodec.Codec // в чем пишутся запросы; ответы узнаются по первому байту
+	token        string
+	broken       bool
+	capabilities []string
+	server       *ResponseHello
+
+	events    chan Event
+	done      chan struct{}
+	closeOnce *sync.Once
+}
+
+// Dial подключается к порту запросов и к порту рассылок. Сервер связывает их в пару по порядку,
+// поэтому сначала подключается порт запросов.
+func Dial(ctx context.Context, reqAddr string, brcastAddr string, config *Config) (*Client, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	connReq, err := dial(ctx, reqAddr, config.TLS)
+	if err != nil {
+		return nil, err
+	}
+	connBrcast, err := dial(ctx, brcastAddr, config.TLS)
+	if err != nil {
+		connReq.Close()
+		return nil, err
+	}
+	c := NewClient(connReq, connBrcast, config)
+	if config.NoHello {
+		return c, nil
+	}
+	_, err = c.Hello(ctx)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// dial подключается к адресу, по TLS, если он задан.
+// Рукопожатие происходит при первой записи или чтении: сервер начинает его только после того,
+// как приняты оба соединения.
+func dial(ctx context.Context, addr string, tlsConfig *tls.Config) (net.Conn, error) {
+	d := net.Dialer{}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil || tlsConfig == nil {
+		return conn, err
+	}
+	if tlsConfig.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = host
+	}
+	return tls.Client(conn, tlsConfig), nil
+}
+
+// NewClient создает клиента поверх уже открытых соединений
+func NewClient(connReq net.Conn, connBrcast net.Conn, config *Config) *Client {
+	if config == nil {
+		config = &Config{}
+	}
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	eventBuffer := config.EventBuffer
+	if eventBuffer == 0 {
+		eventBuffer = DefaultEventBuffer
+	}
+	capabilities := config.Capabilities
+	if config.Encoding == xocodec.Msgpack.Name() {
+		capabilities = append(append([]string{}, capabilities...), xocodec.Msgpack.Name())
+	}
+	c := &Client{
+		Mutex:        &sync.Mutex{},
+		ConnReq:      connReq,
+		ConnBrcast:   connBrcast,
+		Timeout:      timeout,
+		reader:       bufio.NewReader(connReq),
+		codec:        xocodec.JSON,
+		capabilities: capabilities,
+		events:       make(chan Event, eventBuffer),
+		done:         make(chan struct{}),
+		closeOnce:    &sync.Once{},
+	}
+	go c.readEvents()
+	return c
+}
+
+// Close закрывает оба соединения. Канал Events закрывается после этого.
+func (c *Client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		err = errors.Join(c.ConnReq.Close(), c.ConnBrcast.Close())
+	})
+	return err
+}
+
+// Token - токен после Register или Login
+func (c *Client) Token() string {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	return c.token
+}
+
+// SetToken задает токен, полученный раньше, например другим соединением
+func (c *Client) SetToken(token string) {
+	c.Mutex.Lock()
+	c.token = token
+	c.Mutex.Unlock()
+}
+
+type request struct {
+	Method   string `json:"method"`
+	Token    string `json:"token,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Answer   string `json:"answer,omitempty"`
+	Vote     *int64 `json:"vote,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Emoji    string `json:"emoji,omitempty"`
+	Accept   *bool  `json:"accept,omitempty"`
+
+	MaxUsers  *int64 `json:"maxusers,omitempty"`
+	MaxRounds *int64 `json:"maxrounds,omitempty"`
+	Prompts   *int64 `json:"prompts,omitempty"`
+	Teams     *int64 `json:"teams,omitempty"`
+	Mode      string `json:"mode,omitempty"`
+	Team      string `json:"team,omitempty"`
+
+	Version      *int64   `json:"version,omitempty"`
+	Capabilities []string `json:"capabilities,omitempty"`
+}
+
+// call отправляет запрос и читает ответ в resp. Статус, отличный от StatusOk, возвращается как *StatusError.
+func (c *Client) call(ctx context.Context, req *request, resp any) error {
+	c.Mutex.Lock()
+	if req.Method != "register" && req.Method != "login" && req.Method != "hello" {
+		req.Token = c.token
+	}
+	frame, codec, err := c.roundTrip(ctx, req)
+	c.Mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	status := &StatusError{}
+	err = codec.Unmarshal(frame, status)
+	if err != nil {
+		return err
+	}
+	if status.Status != StatusOk {
+		status.Method = req.Method
+		return status
+	}
+	if resp == nil {
+		return nil
+	}
+	return codec.Unmarshal(frame, resp)
+}
+
+// Raw отправляет запрос как есть, без токена клиента, и возвращает ответ сервера, не разбирая статус.
+// Ответ всегда в JSON, в какой бы кодировке его ни прислал сервер.
+func (c *Client) Raw(ctx context.Context, req any) (json.RawMessage, error) {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	frame, codec, err := c.roundTrip(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return xocodec.ToJSON(frame, codec)
+}
+
+// roundTrip пишет запрос и читает один ответ. Вызывается под c.Mutex.
+func (c *Client) roundTrip(ctx context.Context, req any) ([]byte, xocodec.Codec, error) {
+	if c.broken {
+		return nil, nil, ErrBroken
+	}
+	data, err := c.codec.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	// JSON-запрос - это строка, MessagePack-словарь сам знает, где кончается
+	if c.codec == xocodec.JSON {
+		data = append(data, '\n')
+	}
+
+	deadline := time.Now().Add(c.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.ConnReq.SetDeadline(deadline)
+	defer c.ConnReq.SetDeadline(time.Time{})
+	// Отмена контекста прерывает ожидание
+	stop := context.AfterFunc(ctx, func() {
+		c.ConnReq.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	var frame []byte
+	var codec xocodec.Codec
+	_, err = c.ConnReq.Write(data)
+	if err == nil {
+		frame, codec, err = xocodec.ReadFrame(c.reader, maxFrameLen)
+	}
+	if err != nil {
+		c.broken = true
+		c.ConnReq.Close()
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		return nil, nil, err
+	}
+	return frame, codec, nil
+}
+
+// Hello сообщает серверу версию протокола клиента и узнает версию и возможности сервера.
+// Dial вызывает его сам. Если клиент слишком стар, ошибка с кодом CodeUpgradeRequired.
+// С ответа на hello запросы пишутся в кодировке, которую выбрал сервер.
+func (c *Client) Hello(ctx context.Context) (*ResponseHello, error) {
+	resp := &ResponseHello{}
+	version := int64(ProtocolVersion)
+	capabilities := c.capabilities
+	if capabilities == nil {
+		capabilities = []string{}
+	}
+	err := c.call(ctx, &request{Method: "hello", Version: &version, Capabilities: capabilities}, resp)
+	if err != nil {
+		return nil, err
+	}
+	c.Mutex.Lock()
+	c.server = resp
+	// Старый сервер не сообщает кодировку - значит, JSON
+	c.codec = xocodec.JSON
+	if codec := xocodec.ByName(resp.Encoding); codec != nil {
+		c.codec = codec
+	}
+	c.Mutex.Unlock()
+	return resp, nil
+}
+
+// Server - ответ сервера на Hello, nil до него
+func (c *Client) Server() *ResponseHello {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	return c.server
+}
+
+// Register создает пользователя и запоминает его токен
+func (c *Client) Register(ctx context.Context, username string, password string) (*ResponseToken, error) {
+	resp := &ResponseToken{}
+	err := c.call(ctx, &request{Method: "register", Username: username, Password: password}, resp)
+	if err != nil {
+		return nil, err
+	}
+	c.SetToken(resp.Token)
+	return resp, nil
+}
+
+// Login входит под существующим пользователем и запоминает его токен
+func (c *Client) Login(ctx context.Context, username string, password string) (*ResponseToken, error) {
+	resp := &ResponseToken{}
+	err := c.call(ctx, &request{Method: "login", Username: username, Password: password}, resp)
+	if err != nil {
+		return nil, err
+	}
+	c.SetToken(resp.Token)
+	return resp, nil
+}
+
+func (c *Client) GetUsername(ctx context.Context) (*ResponseUsername, error) {
+	resp := &ResponseUsername{}
+	err := c.call(ctx, &request{Method: "getusername"}, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// EnterGame входит в комнату и возвращает игроков, которые уже в ней
+func (c *Client) EnterGame(ctx context.Context) (*ResponseGamePlayers, error) {
+	resp := &ResponseGamePlayers{}
+	err := c.call(ctx, &request{Method: "entergame"}, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) GetQuestion(ctx context.Context) (*ResponseQuestion, error) {
+	resp := &ResponseQuestion{}
+	err := c.call(ctx, &request{Method: "getquestion"}, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// SaveAnswer отвечает на текущий вопрос. LastAnswer в ответе - это был последний вопрос раунда.
+func (c *Client) SaveAnswer(ctx context.Context, answer string) (*ResponseAnswer, error) {
+	resp := &ResponseAnswer{}
+	err := c.call(ctx, &request{Method: "saveanswer", Answer: answer}, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) GetDuel(ctx context.Context) (*ResponseDuel, error) {
+	resp := &ResponseDuel{}
+	err := c.call(ctx, &request{Method: "getduel"}, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// SaveVote голосует за вариант с номером vote из ResponseDuel.Answers текущей дуэли
+func (c *Client) SaveVote(ctx context.Context, vote int64) error {
+	return c.call(ctx, &request{Method: "savevote", Vote: &vote}, nil)
+}
+
+func (c *Client) GetDuelResult(ctx context.Context) (*ResponseDuelResult, error) {
+	resp := &ResponseDuelResult{}
+	err := c.call(ctx, &request{Method: "getduelresult"}, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) GetRoundResult(ctx context.Context) (*ResponseRoundResult, error) {
+	resp := &ResponseRoundResult{}
+	err := c.call(ctx, &request{Method: "getroundresult"}, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) GetGameResult(ctx context.Context) (*ResponseRoundResult, error) {
+	resp := &ResponseRoundResult{}
+	err := c.call(ctx, &request{Method: "getgameresult"}, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) SendChat(ctx context.Context, text string) error {
+	return c.call(ctx, &request{Method: "sendchat", Text: text}, nil)
+}
+
+// React отправляет эмодзи к дуэли, которую сейчас показывают
+func (c *Client) React(ctx context.Context, emoji string) error {
+	return c.call(ctx, &request{Method: "react", Emoji: emoji}, nil)
+}
+
+// SubmitPrompt присылает свой вопрос, пока комната собирается. Другим игрокам он может достаться в дуэли.
+func (c *Client) SubmitPrompt(ctx context.Context, text string) error {
+	return c.call(ctx, &request{Method: "submitprompt", Text: text}, nil)
+}
+
+// SavePrompts после игры добавляет присланные в ней вопросы в личный пакет и возвращает весь пакет
+func (c *Client) SavePrompts(ctx context.Context) (*ResponsePrompts, error) {
+	resp := &ResponsePrompts{}
+	err := c.call(ctx, &request{Method: "saveprompts"}, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// PlayAgain голосует после игры за реванш той же компанией (accept) или против.
+// Чем кончилось, придет рассылкой EventRematch или EventRematchCancelled.
+func (c *Client) PlayAgain(ctx context.Context, accept bool) error {
+	return c.call(ctx, &request{Method: "playagain", Accept: &accept}, nil)
+}
+
+// Kick выгоняет игрока из комнаты. Только для хозяина, пока комната собирается.
+func (c *Client) Kick(ctx context.Context, username string) error {
+	return c.call(ctx, &request{Method: "kick", Username: username}, nil)
+}
+
+// RoomSettings - новые настройки комнаты, nil - не менять
+type RoomSettings struct {
+	MaxUsers  *int64
+	MaxRounds *int64
+	Prompts   *int64 // сколько вопросов может прислать каждый игрок
+	Teams     *int64 // сколько команд, 0 - каждый сам за себя
+	Mode      string // режим игры: classic, bluff; пусто - не менять
+}
+
+// SetRoomSettings меняет настройки комнаты. Только для хозяина, пока комната собирается.
+// Если игроков в комнате уже столько, сколько теперь можно, игра начинается.
+func (c *Client) SetRoomSettings(ctx context.Context, settings RoomSettings) error {
+	return c.call(ctx, &request{Method: "roomsettings", MaxUsers: settings.MaxUsers, MaxRounds: settings.MaxRounds, Prompts: settings.Prompts, Teams: settings.Teams, Mode: settings.Mode}, nil)
+}
+
+// StartGame начинает игру с теми, кто уже в комнате. Только для хозяина.
+func (c *Client) StartGame(ctx context.Context) error {
+	return c.call(ctx, &request{Method: "startgame"}, nil)
+}
+
+// JoinTeam выбирает команду, пока комната собирается. Команды комнаты - ResponseGamePlayers.Teams.
+func (c *Client) JoinTeam(ctx context.Context, team string) error {
+	return c.call(ctx, &request{Method: "jointeam", Team: team}, nil)
+}
+
+// PauseGame ставит игру на паузу: ответы и голоса не принимаются, пока не будет ResumeGame. Только для хозяина.
+func (c *Client) PauseGame(ctx context.Context) error {
+	return c.call(ctx, &request{Method: "pausegame"}, nil)
+}
+
+// ResumeGame снимает игру с паузы. Только для хозяина.
+func (c *Client) ResumeGame(ctx context.Context) error {
+	return c.call(ctx, &request{Method: "resumegame"}, nil)
+}
+
+// NewTLSConfig - настройки TLS для Config.TLS. caFile - сертификат, которым проверять сервер
+// (пусто - системные), insecure отключает проверку (самоподписанный сертификат, только для тестов).
+func NewTLSConfig(caFile string, insecure bool) (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: insecure}
+	if caFile == "" {
+		return config, nil
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	config.RootCAs = x509.NewCertPool()
+	if !config.RootCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("xoclient: no certificates in %s", caFile)
+	}
+	return config, nil
+}
@@ -0,0 +1,62 @@
+package xoclient
+
+import (
+	"bufio"
+	"context"
+	"io"
+
+	"Xo-xo-touch/xocodec"
+)
+
+// Events - рассылки в порядке прихода. Канал закрывается, когда соединение рассылок закрыто.
+// Пока канал полон, новые рассылки не читаются.
+func (c *Client) Events() <-chan Event {
+	return c.events
+}
+
+func (c *Client) readEvents() {
+	defer close(c.events)
+	reader := bufio.NewReader(c.ConnBrcast)
+	for {
+		frame, codec, err := xocodec.ReadFrame(reader, maxFrameLen)
+		if err != nil {
+			return
+		}
+		event := Event{}
+		err = codec.Unmarshal(frame, &event)
+		if err != nil {
+			continue
+		}
+		event.Raw, err = xocodec.ToJSON(frame, codec)
+		if err != nil {
+			continue
+		}
+		select {
+		case c.events <- event:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// WaitEvent ждет рассылку с одним из сообщений messages, пропуская остальные. Без messages - любую.
+func (c *Client) WaitEvent(ctx context.Context, messages ...string) (Event, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return Event{}, ctx.Err()
+		case event, ok := <-c.events:
+			if !ok {
+				return Event{}, io.EOF
+			}
+			if len(messages) == 0 {
+				return event, nil
+			}
+			for _, m := range messages {
+				if event.Message == m {
+					return event, nil
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package xoclient
+
+import "encoding/json"
+
+// Статусы ответов сервера
+const (
+	StatusOk              int64 = 200
+	ErrAlreadyd           int64 = 409
+	ErrBadRequest         int64 = 400 // запрос не прошел проверку: нет поля, лишнее поле, значение вне диапазона
+	ErrInvalidData        int64 = 401
+	ErrAlreadyLoggedIn    int64 = 403
+	ErrUnknownMethod      int64 = 404
+	ErrMethodIsNotAllowed int64 = 405
+	ErrNotAcceptable      int64 = 406
+	ErrTooLarge           int64 = 413
+	ErrUpgradeRequired    int64 = 426
+	ErrTooManyRequests    int64 = 429
+	ErrUnavailable        int64 = 503
+)
+
+// Коды ошибок сервера (StatusError.Code). В отличие от статуса, код однозначен:
+// например, 405 бывает и not_everyone_answered, и voting_over. Сервер берет коды отсюда же.
+const (
+	CodeInvalidRequest      = "invalid_request"       // запрос не прошел проверку, см. StatusError.Field
+	CodeUnknownMethod       = "unknown_method"        // нет такого метода
+	CodeRequestTooLarge     = "request_too_large"     // строка запроса длиннее лимита
+	CodeRateLimited         = "rate_limited"          // слишком частые запросы
+	CodeUpgradeRequired     = "upgrade_required"      // версия протокола клиента слишком старая
+	CodeServerShuttingDown  = "server_shutting_down"  // сервер останавливается, новые игры не начинаются
+	CodeUsernameTaken       = "username_taken"        // при регистрации
+	CodeWrongCredentials    = "wrong_credentials"     // неверное имя или пароль
+	CodeAlreadyLoggedIn     = "already_logged_in"     // вход с другого соединения
+	CodeInvalidToken        = "invalid_token"         // токен испорчен, нужно войти заново
+	CodeUnknownUser         = "unknown_user"          // токен верный, но пользователя нет
+	CodeTextTooShort        = "text_too_short"        // имя, ответ или сообщение чата
+	CodeTextTooLong         = "text_too_long"         // имя, ответ или сообщение чата
+	CodeTextRejected        = "text_rejected"         // текст не прошел модерацию
+	CodeEmojiNotAllowed     = "emoji_not_allowed"     // реакция не из списка
+	CodeNotInGame           = "not_in_game"           // игрок не в комнате
+	CodeGameNotStarted      = "game_not_started"      // комната еще собирается
+	CodeAlreadyAnswered     = "already_answered"      // ответы на все вопросы раунда уже есть
+	CodeAlreadyVoted        = "already_voted"         // уже проголосовал за дуэль: второй голос и смена ответа запрещены
+	CodeNotEveryoneAnswered = "not_everyone_answered" // голосование еще не началось
+	CodeVotingOver          = "voting_over"           // голосование в раунде закончилось
+	CodeNotVoting           = "not_voting"            // реакции только пока показывают дуэль
+	CodeOwnDuel             = "own_duel"              // участник дуэли не голосует за нее
+	CodeNoDuelResult        = "no_duel_result"        // ни одна дуэль раунда еще не закончилась
+	CodePromptsDisabled     = "prompts_disabled"      // комната не принимает вопросы игроков
+	CodePromptsClosed       = "prompts_closed"        // вопросы принимаются, только пока комната собирается
+	CodeTooManyPrompts      = "too_many_prompts"      // игрок уже прислал все свои вопросы
+	CodeGameNotEnded        = "game_not_ended"        // вопросы сохраняются в пакет и реванш предлагается после игры
+	CodeRematchOver         = "rematch_over"          // реванш уже решен или выключен
+	CodeNotHost             = "not_host"              // управлять комнатой может только ее хозяин
+	CodeNotInLobby          = "not_in_lobby"          // комната уже не собирается, настройки и состав не меняются
+	CodeNoSuchPlayer        = "no_such_player"        // такого игрока нет в комнате
+	CodeKicked              = "kicked"                // хозяин выгнал игрока из этой комнаты
+	CodeNotEnoughPlayers    = "not_enough_players"    // игру начинают хотя бы трое
+	CodeGamePaused          = "game_paused"           // игра на паузе: ответы и голоса не принимаются
+	CodeNotPaused           = "not_paused"            // снимать с паузы нечего
+	CodeGameEnded           = "game_ended"            // игра уже закончилась
+	CodeTeamsDisabled       = "teams_disabled"        // комната играет без команд
+	CodeTeamFull            = "team_full"             // в команде уже нет мест
+	CodeUnevenTeams         = "uneven_teams"          // игроков нельзя поровну разделить на команды
+	CodeAnswerIsTruth       = "answer_is_truth"       // bluff: ложный ответ совпал с верным
+)
+
+type ResponseHello struct {
+	Status     int64    `json:"status"`
+	Version    int64    `json:"version"`    // версия протокола сервера
+	MinVersion int64    `json:"minversion"` // клиенты старше этой версии отклоняются
+	Server     string   `json:"server"`     // версия сборки сервера
+	Features   []string `json:"features"`
+	Encoding   string   `json:"encoding"` // в чем сервер пишет после hello: "json" или "msgpack"
+}
+
+// HasFeature - умеет ли сервер feature, например "chat"
+func (h *ResponseHello) HasFeature(feature string) bool {
+	for _, f := range h.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+type ResponseToken struct {
+	Status int64  `json:"status"`
+	Token  string `json:"token"`
+}
+
+type ResponseUsername struct {
+	Status   int64  `json:"status"`
+	Username string `json:"username"`
+}
+
+type ResponseGamePlayers struct {
+	Status    int64    `json:"status"`
+	Usernames []string `json:"usernames"`
+	Mode      string   `json:"mode"`            // режим игры: classic, bluff
+	Prompts   int64    `json:"prompts"`         // сколько вопросов можно прислать SubmitPrompt, 0 - нисколько
+	Host      string   `json:"host"`            // хозяин комнаты
+	Teams     []string `json:"teams,omitempty"` // команды для JoinTeam, пусто - игра без команд
+}
+
+type ResponseQuestion struct {
+	Status   int64  `json:"status"`
+	Question string `json:"question"`
+}
+
+type ResponseAnswer struct {
+	Status     int64 `json:"status"`
+	LastAnswer bool  `json:"lastanswer"`
+}
+
+type ResponseDuel struct {
+	Status   int64    `json:"status"`
+	Question string   `json:"question"`
+	Answers  []string `json:"answers"` // варианты для SaveVote: в classic - два ответа, в bluff - три, один из них верный
+	DuelNum  int64    `json:"duelnum"`
+}
+
+type ResponseDuelResult struct {
+	Status    int64    `json:"status"`
+	Question  string   `json:"question"`
+	Usernames []string `json:"usernames"`
+	Answers   []string `json:"answers"`
+	VotesFor0 []string `json:"votesfor0"`
+	VotesFor1 []string `json:"votesfor1"`
+	Author    string   `json:"author"` // кто прислал вопрос, пусто - вопрос из пакета
+
+	Truth         string   `json:"truth"`         // bluff: верный ответ, Answers - ложные
+	VotesForTruth []string `json:"votesfortruth"` // bluff: кто нашел верный ответ
+}
+
+type ResponsePrompts struct {
+	Status  int64    `json:"status"`
+	Prompts []string `json:"prompts"` // личный пакет вопросов
+}
+
+type ResponseRoundResult struct {
+	Status int64            `json:"status"`
+	Points map[string]int64 `json:"points"`
+	Teams  map[string]int64 `json:"teams,omitempty"` // очки команд, если игра командная
+}
+
+// Рассылки игры (Event.Message)
+const (
+	EventNewPlayer            = "newplayer"
+	EventGameStarted          = "gamestarted"
+	EventEveryoneAnswered     = "everyoneanswered"
+	EventNewDuelVotingStarted = "newduelvotingstarted"
+	EventDuelVotingEnded      = "duelvotingended"
+	EventRoundVotingEnded     = "roundvotingended"
+	EventNewRoundStarted      = "newroundstarted"
+	EventGameEnded            = "gameended"
+	EventChat                 = "chat"
+	EventReaction             = "reaction"
+	EventServerShuttingDown   = "servershuttingdown"
+	EventPlayAgain            = "playagain"        // кто-то проголосовал за реванш или против
+	EventRematch              = "rematch"          // реванш будет, игра начнется с EventGameStarted
+	EventRematchCancelled     = "rematchcancelled" // реванша не будет
+	EventNewHost              = "newhost"          // прошлый хозяин отключился
+	EventKicked               = "kicked"           // хозяин выгнал игрока, может быть, этого
+	EventRoomSettings         = "roomsettings"     // хозяин поменял настройки комнаты
+	EventGamePaused           = "gamepaused"       // хозяин поставил игру на паузу
+	EventGameResumed          = "gameresumed"      // хозяин снял игру с паузы
+	EventTeamChanged          = "teamchanged"      // игрок выбрал команду
+	EventTeams                = "teams"            // составы команд, перед EventGameStarted
+)
+
+// Event - одна рассылка. Заполнены только поля, которые есть у этого вида рассылки, Raw - как пришло.
+type Event struct {
+	Message   string              `json:"message"`
+	Username  string              `json:"username"`  // newplayer, chat, reaction, playagain, newhost, kicked, gamepaused, gameresumed, teamchanged
+	Text      string              `json:"text"`      // chat
+	Emoji     string              `json:"emoji"`     // reaction
+	DuelNum   int64               `json:"duelnum"`   // reaction
+	Grace     float64             `json:"grace"`     // servershuttingdown, seconds
+	Accept    bool                `json:"accept"`    // playagain
+	Usernames []string            `json:"usernames"` // rematch, все игроки новой игры
+	MaxUsers  int64               `json:"maxusers"`  // roomsettings
+	MaxRounds int64               `json:"maxrounds"` // roomsettings
+	Prompts   int64               `json:"prompts"`   // roomsettings
+	Teams     int64               `json:"teams"`     // roomsettings
+	Mode      string              `json:"mode"`      // roomsettings
+	Team      string              `json:"team"`      // teamchanged
+	Members   map[string][]string `json:"members"`   // teams, команда -> игроки
+	Raw       json.RawMessage     `json:"-"`
+}
@@ -0,0 +1,135 @@
+// Package xocodec - кодировки кадров протокола Xo-xo-touch: JSON и MessagePack.
+//
+// Кодировка соединения выбирается в hello, но каждый кадр и так можно узнать по первому байту:
+// JSON-объект начинается с '{', а MessagePack-словарь - с 0x80-0x8f, 0xde или 0xdf.
+// Поэтому читатель не обязан знать, договорились ли уже стороны.
+//
+// Любая структура с json-тегами кодируется обеими кодировками одинаково:
+// MessagePack строится из того же дерева значений, что и JSON.
+package xocodec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+type Codec interface {
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	JSON    Codec = jsonCodec{}
+	Msgpack Codec = msgpackCodec{}
+)
+
+// ByName - кодировка по имени из hello, nil, если такой нет
+func ByName(name string) Codec {
+	switch name {
+	case JSON.Name():
+		return JSON
+	case Msgpack.Name():
+		return Msgpack
+	}
+	return nil
+}
+
+// ErrTooLarge - кадр длиннее разрешенного
+var ErrTooLarge = errors.New("xocodec: frame is too large")
+
+// IsMsgpack - начинается ли с b MessagePack-словарь
+func IsMsgpack(b byte) bool {
+	return (b >= 0x80 && b <= 0x8f) || b == 0xde || b == 0xdf
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                       { return "json" }
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// ReadFrame читает один кадр - JSON-значение или MessagePack-словарь - и узнает его кодировку.
+// maxLen ограничивает длину кадра в байтах, 0 - без ограничения.
+func ReadFrame(r *bufio.Reader, maxLen int) ([]byte, Codec, error) {
+	// Пробелы и переводы строк между JSON-кадрами
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		if b == ' ' || b == '\t' || b == '\r' || b == '\n' {
+			continue
+		}
+		r.UnreadByte()
+		if IsMsgpack(b) {
+			frame, err := readMsgpackFrame(r, maxLen)
+			return frame, Msgpack, err
+		}
+		frame, err := readJsonFrame(r, maxLen)
+		return frame, JSON, err
+	}
+}
+
+// readJsonFrame читает одно JSON-значение: объект или массив - до парной скобки, остальное - до разделителя
+func readJsonFrame(r *bufio.Reader, maxLen int) ([]byte, error) {
+	frame := []byte{}
+	depth := 0
+	inString := false
+	escaped := false
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(frame) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if maxLen > 0 && len(frame) >= maxLen {
+			return nil, ErrTooLarge
+		}
+		if depth == 0 && !inString && len(frame) > 0 && (b == ' ' || b == '\t' || b == '\r' || b == '\n' || b == '{' || b == '[') {
+			// Скаляр закончился
+			r.UnreadByte()
+			return frame, nil
+		}
+		frame = append(frame, b)
+		switch {
+		case inString && escaped:
+			escaped = false
+		case inString && b == '\\':
+			escaped = true
+		case b == '"':
+			inString = !inString
+		case inString:
+		case b == '{' || b == '[':
+			depth += 1
+		case b == '}' || b == ']':
+			depth -= 1
+			if depth <= 0 {
+				return frame, nil
+			}
+		}
+	}
+}
+
+// ToJSON переводит кадр в JSON, например чтобы показать его человеку
+func ToJSON(frame []byte, codec Codec) (json.RawMessage, error) {
+	if codec == JSON {
+		return bytes.Clone(frame), nil
+	}
+	var v any
+	err := codec.Unmarshal(frame, &v)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("xocodec: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,160 @@
+package xocodec_test
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"Xo-xo-touch/xocodec"
+	"Xo-xo-touch/xoserver"
+)
+
+// responses - по одному ответу и рассылке сервера каждого вида
+var responses = []any{
+	&xoserver.ResponseError{Status: 409, Code: "already_voted", Message: "you have already voted", Method: "savevote", Field: "vote"},
+	&xoserver.ResponseHello{Status: 200, Version: 2, MinVersion: 1, Server: "dev", Features: []string{"chat", "msgpack"}, Encoding: "msgpack"},
+	&xoserver.ResponseToken{Status: 200, Token: strings.Repeat("t", 300)},
+	&xoserver.ResponseUsername{Status: 200, Username: "игрок"},
+	&xoserver.ResponseNewPlayer{Message: "newplayer", Username: "player1"},
+	&xoserver.ResponseGamePlayers{Status: 200, Usernames: []string{}},
+	&xoserver.ResponseBrcastMessage{Message: "gamestarted"},
+	&xoserver.ResponseQuestion{Status: 200, Question: "Без чего не обходится деревенская свадьба?"},
+	&xoserver.ResponseDuel{Status: 200, Question: "q", Answers: []string{"a", ""}, DuelNum: 4},
+	&xoserver.ResponseDuelResult{Status: 200, Question: "q", Usernames: []string{"a", "b"}, Answers: []string{"1", "2"}, VotesFor0: []string{"c"}, VotesFor1: nil},
+	&xoserver.ResponseRoundResult{Status: 200, Points: map[string]int64{"a": 0, "b": -40, "c": 1 << 40}},
+	&xoserver.ResponseChatMessage{Message: "chat", Username: "a", Text: "привет 👋"},
+	&xoserver.ResponseReaction{Message: "reaction", Username: "a", Emoji: "🔥", DuelNum: 300},
+	&xoserver.ResponseShutdown{Message: "servershuttingdown", Grace: 1.5},
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, codec := range []xocodec.Codec{xocodec.JSON, xocodec.Msgpack} {
+		for _, resp := range responses {
+			data, err := codec.Marshal(resp)
+			if err != nil {
+				t.Fatalf("%s: marshal %T: %v", codec.Name(), resp, err)
+			}
+			got := reflect.New(reflect.TypeOf(resp).Elem()).Interface()
+			err = codec.Unmarshal(data, got)
+			if err != nil {
+				t.Fatalf("%s: unmarshal %T: %v", codec.Name(), resp, err)
+			}
+			// nil и пустой список после JSON тоже не различить
+			want, _ := xocodec.JSON.Marshal(resp)
+			gotJSON, _ := xocodec.JSON.Marshal(got)
+			if !bytes.Equal(want, gotJSON) {
+				t.Errorf("%s: %T: got %s, want %s", codec.Name(), resp, gotJSON, want)
+			}
+		}
+	}
+}
+
+// TestReadFrame - поток из ответов в обеих кодировках вперемешку, как после hello
+func TestReadFrame(t *testing.T) {
+	stream := &bytes.Buffer{}
+	codecs := []xocodec.Codec{}
+	for i, resp := range responses {
+		codec := xocodec.JSON
+		if i%2 == 1 {
+			codec = xocodec.Msgpack
+		}
+		data, err := codec.Marshal(resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream.Write(data)
+		codecs = append(codecs, codec)
+	}
+
+	reader := bufio.NewReader(stream)
+	for i, resp := range responses {
+		frame, codec, err := xocodec.ReadFrame(reader, 4096)
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if codec != codecs[i] {
+			t.Fatalf("frame %d: encoding %s, want %s", i, codec.Name(), codecs[i].Name())
+		}
+		got, err := xocodec.ToJSON(frame, codec)
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		// Ключи MessagePack отсортированы, так что сравниваются значения, а не байты
+		want, _ := xocodec.JSON.Marshal(resp)
+		var gotValue, wantValue any
+		xocodec.JSON.Unmarshal(got, &gotValue)
+		xocodec.JSON.Unmarshal(want, &wantValue)
+		if !reflect.DeepEqual(gotValue, wantValue) {
+			t.Errorf("frame %d: got %s, want %s", i, got, want)
+		}
+	}
+	_, _, err := xocodec.ReadFrame(reader, 4096)
+	if err != io.EOF {
+		t.Errorf("after the last frame: %v, want EOF", err)
+	}
+}
+
+func TestReadFrameErrors(t *testing.T) {
+	long, _ := xocodec.Msgpack.Marshal(&xoserver.ResponseToken{Token: strings.Repeat("t", 100)})
+	tests := []struct {
+		data   []byte
+		maxLen int
+		err    error
+	}{
+		{long, 64, xocodec.ErrTooLarge},
+		{[]byte(`{"token": "` + strings.Repeat("t", 100) + `"}`), 64, xocodec.ErrTooLarge},
+		{long[:20], 0, io.ErrUnexpectedEOF},
+		{[]byte(`{"status": 200`), 64, io.ErrUnexpectedEOF},
+		{[]byte{0x81, 0x01, 0x02}, 64, xocodec.ErrInvalidMsgpack},            // ключ - не строка
+		{[]byte{0x81, 0xa1, 'a', 0xc7, 0x01}, 64, xocodec.ErrInvalidMsgpack}, // ext
+		// Длина из заголовка больше лимита: память под нее не заводится
+		{[]byte{0x81, 0xa1, 'a', 0xdb, 0xff, 0xff, 0xff, 0xff}, 64, xocodec.ErrTooLarge},
+		{append(bytes.Repeat([]byte{0x81, 0xa1, 'a'}, 100), 0xc0), 0, xocodec.ErrInvalidMsgpack}, // слишком глубоко
+	}
+	for _, test := range tests {
+		_, _, err := xocodec.ReadFrame(bufio.NewReader(bytes.NewReader(test.data)), test.maxLen)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%x: got %v, want %v", test.data, err, test.err)
+		}
+	}
+}
+
+// FuzzMsgpack: любой кадр, который удалось прочитать, переводится в JSON и обратно без потерь
+func FuzzMsgpack(f *testing.F) {
+	for _, resp := range responses {
+		data, _ := xocodec.Msgpack.Marshal(resp)
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		frame, codec, err := xocodec.ReadFrame(bufio.NewReader(bytes.NewReader(data)), 1<<16)
+		if err != nil || codec != xocodec.Msgpack {
+			return
+		}
+		asJSON, err := xocodec.ToJSON(frame, codec)
+		if err != nil {
+			return
+		}
+		var v any
+		err = xocodec.JSON.Unmarshal(asJSON, &v)
+		if err != nil {
+			t.Fatalf("ToJSON gave invalid JSON %s: %v", asJSON, err)
+		}
+		again, err := xocodec.Msgpack.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		againJSON, err := xocodec.ToJSON(again, xocodec.Msgpack)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var againValue any
+		xocodec.JSON.Unmarshal(againJSON, &againValue)
+		if !reflect.DeepEqual(v, againValue) {
+			t.Fatalf("round trip changed the value: %s -> %s", asJSON, againJSON)
+		}
+	})
+}
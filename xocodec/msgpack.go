@@ -0,0 +1,379 @@
+package xocodec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// MessagePack (https://msgpack.org). Поддерживается то, что бывает в JSON:
+// nil, bool, целые, float, строки, массивы и словари со строковыми ключами.
+// bin читается как строка, ext не поддерживается.
+
+const maxDepthConst = 64
+
+// ErrInvalidMsgpack - кадр не разобрать. Где кончается такой кадр, неизвестно, так что читать дальше нельзя.
+var ErrInvalidMsgpack = errors.New("xocodec: invalid msgpack")
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return "msgpack" }
+
+// Marshal кодирует v так же, как json.Marshal: по json-тегам
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var tree any
+	err = decoder.Decode(&tree)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	err = encodeMsgpack(buf, tree)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal раскладывает MessagePack в v так же, как json.Unmarshal раскладывает JSON
+func (msgpackCodec) Unmarshal(data []byte, v any) error {
+	d := &msgpackDecoder{r: bufio.NewReader(bytes.NewReader(data)), budget: len(data)}
+	tree, err := d.decode(0)
+	if err != nil {
+		return err
+	}
+	if d.read != len(data) {
+		return fmt.Errorf("%w: %d bytes after the value", ErrInvalidMsgpack, len(data)-d.read)
+	}
+	if target, ok := v.(*any); ok {
+		*target = tree
+		return nil
+	}
+	data, err = json.Marshal(tree)
+	if err != nil {
+		return fmt.Errorf("xocodec: %w", err)
+	}
+	return json.Unmarshal(data, v)
+}
+
+func encodeMsgpack(buf *bytes.Buffer, v any) error {
+	switch x := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if x {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case json.Number:
+		n, err := x.Int64()
+		if err == nil {
+			encodeInt(buf, n)
+			return nil
+		}
+		f, err := x.Float64()
+		if err != nil {
+			return fmt.Errorf("xocodec: number %s: %w", x, err)
+		}
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+	case int64:
+		encodeInt(buf, x)
+	case float64:
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(x))
+	case string:
+		n := len(x)
+		switch {
+		case n < 32:
+			buf.WriteByte(0xa0 | byte(n))
+		case n <= math.MaxUint8:
+			buf.WriteByte(0xd9)
+			buf.WriteByte(byte(n))
+		case n <= math.MaxUint16:
+			buf.WriteByte(0xda)
+			binary.Write(buf, binary.BigEndian, uint16(n))
+		default:
+			buf.WriteByte(0xdb)
+			binary.Write(buf, binary.BigEndian, uint32(n))
+		}
+		buf.WriteString(x)
+	case []any:
+		n := len(x)
+		switch {
+		case n < 16:
+			buf.WriteByte(0x90 | byte(n))
+		case n <= math.MaxUint16:
+			buf.WriteByte(0xdc)
+			binary.Write(buf, binary.BigEndian, uint16(n))
+		default:
+			buf.WriteByte(0xdd)
+			binary.Write(buf, binary.BigEndian, uint32(n))
+		}
+		for _, item := range x {
+			err := encodeMsgpack(buf, item)
+			if err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		n := len(x)
+		switch {
+		case n < 16:
+			buf.WriteByte(0x80 | byte(n))
+		case n <= math.MaxUint16:
+			buf.WriteByte(0xde)
+			binary.Write(buf, binary.BigEndian, uint16(n))
+		default:
+			buf.WriteByte(0xdf)
+			binary.Write(buf, binary.BigEndian, uint32(n))
+		}
+		// Ключи по порядку, чтобы одно и то же значение всегда давало одни и те же байты
+		keys := make([]string, 0, n)
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			encodeMsgpack(buf, k)
+			err := encodeMsgpack(buf, x[k])
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("xocodec: can not encode %T", v)
+	}
+	return nil
+}
+
+func encodeInt(buf *bytes.Buffer, n int64) {
+	switch {
+	case n >= 0 && n <= 127:
+		buf.WriteByte(byte(n))
+	case n >= -32 && n < 0:
+		buf.WriteByte(byte(int8(n)))
+	case n >= math.MinInt8 && n <= math.MaxInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(int8(n)))
+	case n >= math.MinInt16 && n <= math.MaxInt16:
+		buf.WriteByte(0xd1)
+		binary.Write(buf, binary.BigEndian, int16(n))
+	case n >= math.MinInt32 && n <= math.MaxInt32:
+		buf.WriteByte(0xd2)
+		binary.Write(buf, binary.BigEndian, int32(n))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+// msgpackDecoder читает одно значение, не больше budget байт. Прочитанное копится в frame, если он не nil.
+type msgpackDecoder struct {
+	r      *bufio.Reader
+	budget int // 0 - без ограничения
+	read   int
+	frame  *bytes.Buffer
+}
+
+func readMsgpackFrame(r *bufio.Reader, maxLen int) ([]byte, error) {
+	d := &msgpackDecoder{r: r, budget: maxLen, frame: &bytes.Buffer{}}
+	_, err := d.decode(0)
+	if err == io.EOF && d.read > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d.frame.Bytes(), nil
+}
+
+func (d *msgpackDecoder) take(n int) ([]byte, error) {
+	if d.budget > 0 && d.read+n > d.budget {
+		return nil, ErrTooLarge
+	}
+	b := make([]byte, n)
+	_, err := io.ReadFull(d.r, b)
+	if err != nil {
+		return nil, err
+	}
+	d.read += n
+	if d.frame != nil {
+		d.frame.Write(b)
+	}
+	return b, nil
+}
+
+func (d *msgpackDecoder) uint(size int) (uint64, error) {
+	b, err := d.take(size)
+	if err != nil {
+		return 0, err
+	}
+	n := uint64(0)
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
+
+func (d *msgpackDecoder) decode(depth int) (any, error) {
+	if depth > maxDepthConst {
+		return nil, fmt.Errorf("%w: nested deeper than %d", ErrInvalidMsgpack, maxDepthConst)
+	}
+	head, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+	b := head[0]
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b >= 0x80 && b <= 0x8f:
+		return d.decodeMap(int(b&0x0f), depth)
+	case b >= 0x90 && b <= 0x9f:
+		return d.decodeArray(int(b&0x0f), depth)
+	case b >= 0xa0 && b <= 0xbf:
+		return d.decodeString(int(b & 0x1f))
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xd9: // bin8, str8
+		n, err := d.uint(1)
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeString(int(n))
+	case 0xc5, 0xda:
+		n, err := d.uint(2)
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeString(int(n))
+	case 0xc6, 0xdb:
+		n, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeString(int(n))
+	case 0xca:
+		n, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(uint32(n))), nil
+	case 0xcb:
+		n, err := d.uint(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(n), nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := d.uint(1 << (b - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if n > math.MaxInt64 {
+			return float64(n), nil
+		}
+		return int64(n), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (b - 0xd0)
+		n, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		// Знаковое число из size байт
+		shift := 64 - 8*size
+		return int64(n<<shift) >> shift, nil
+	case 0xdc:
+		n, err := d.uint(2)
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(int(n), depth)
+	case 0xdd:
+		n, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(int(n), depth)
+	case 0xde:
+		n, err := d.uint(2)
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(int(n), depth)
+	case 0xdf:
+		n, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(int(n), depth)
+	}
+	return nil, fmt.Errorf("%w: unsupported type 0x%02x", ErrInvalidMsgpack, b)
+}
+
+func (d *msgpackDecoder) decodeString(n int) (any, error) {
+	b, err := d.take(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// capacity - сколько элементов заводить заранее: длина из кадра может быть враньем
+func capacity(n int) int {
+	return min(n, 64)
+}
+
+func (d *msgpackDecoder) decodeArray(n int, depth int) (any, error) {
+	items := make([]any, 0, capacity(n))
+	for i := 0; i < n; i++ {
+		item, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (d *msgpackDecoder) decodeMap(n int, depth int) (any, error) {
+	m := make(map[string]any, capacity(n))
+	for i := 0; i < n; i++ {
+		k, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: map key is %T, not a string", ErrInvalidMsgpack, k)
+		}
+		v, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
@@ -0,0 +1,91 @@
+package xoserver
+
+import (
+	"math/rand"
+	"strings"
+)
+
+// Блеф. У каждого вопроса пакета есть верный ответ. Двое в дуэли придумывают по ложному ответу,
+// похожему на правду, а остальные ищут верный среди перемешанных трех. Кто нашел правду -
+// получает очки, за каждого, кто поверил ложному ответу, очки получает его автор.
+
+// truthPosConst - номер верного ответа в Duel.Votes и Duel.Choices, после ответов игроков
+const truthPosConst = 2
+
+type BluffQuestion struct {
+	Question string
+	Truth    string
+}
+
+var bluffQuestions = []BluffQuestion{
+	{"Первым животным на орбите Земли была собака по кличке _____", "Лайка"},
+	{"Национальное животное Шотландии - _____", "единорог"},
+	{"Стая ворон по-английски называется _____", "убийство"},
+	{"В XIX веке кетчуп продавали в аптеках как _____", "лекарство"},
+	{"Прежнее название Нью-Йорка - _____", "Новый Амстердам"},
+	{"Сердце креветки находится у нее в _____", "голове"},
+	{"Коровы, у которых есть имена, дают больше _____", "молока"},
+	{"Исполнитель роли мистера Бина учился в Оксфорде на _____", "инженера-электрика"},
+	{"Самая маленькая страна в мире - _____", "Ватикан"},
+	{"Этой буквы нет ни в одном названии химического элемента на английском: _____", "J"},
+	{"Глухой композитор, который написал Девятую симфонию, - _____", "Бетховен"},
+	{"Боязнь длинных слов называется _____", "гиппопотомонстросесквиппедалиофобия"},
+}
+
+// bluffTruths - вопрос -> верный ответ
+var bluffTruths = map[string]string{}
+
+func init() {
+	for _, q := range bluffQuestions {
+		bluffTruths[q.Question] = q.Truth
+	}
+}
+
+type bluffMode struct{}
+
+func (bluffMode) Name() string { return "bluff" }
+
+func (bluffMode) FillQuestion(game *Game, duel *Duel, start int64, round map[string]bool) {
+	pack := []string{}
+	for _, q := range bluffQuestions {
+		pack = append(pack, q.Question)
+	}
+	duel.Question = packQuestion(game, pack, start, round)
+	duel.Truth = bluffTruths[duel.Question]
+}
+
+func (bluffMode) CheckAnswer(duel *Duel, answer string) *ResponseError {
+	if strings.EqualFold(strings.TrimSpace(answer), duel.Truth) {
+		return newError(ErrNotAcceptable, CodeAnswerIsTruth, "this is the true answer, make up a fake one")
+	}
+	return nil
+}
+
+// PrepareVoting перемешивает ответы игроков и верный ответ
+func (bluffMode) PrepareVoting(duel *Duel) {
+	duel.Choices = []int64{0, 1, truthPosConst}
+	rand.Shuffle(len(duel.Choices), func(i, j int) { duel.Choices[i], duel.Choices[j] = duel.Choices[j], duel.Choices[i] })
+}
+
+func (bluffMode) Options(duel *Duel) []string {
+	options := []string{}
+	for _, pos := range duel.Choices {
+		if pos == truthPosConst {
+			options = append(options, duel.Truth)
+		} else {
+			options = append(options, duel.Answers[pos])
+		}
+	}
+	return options
+}
+
+func (bluffMode) Vote(game *Game, duel *Duel, voter string, vote int64) {
+	pos := duel.Choices[vote]
+	duel.Votes[pos] = append(duel.Votes[pos], voter)
+	points := 10 * (game.RoundNum + 1)
+	if pos == truthPosConst {
+		addPoints(game, voter, points)
+	} else {
+		addPoints(game, duel.Usernames[pos], points)
+	}
+}
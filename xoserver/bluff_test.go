@@ -0,0 +1,127 @@
+package xoserver
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBluffGame(t *testing.T) {
+	config := testConfig()
+	config.MaxUsersCnt = 3
+	config.Mode = "bluff"
+	mem, players := newTestLobby(t, config, 3, 0)
+	for _, p := range players {
+		if resp := p.send(mem, RequestParams{Method: "entergame"}); resp["mode"] != "bluff" {
+			t.Fatalf("entergame: %v", resp)
+		}
+	}
+	mem.Mutex.Lock()
+	game := mem.Games[0]
+	mem.Mutex.Unlock()
+	waitPhase(t, mem, game, PhaseAnswering)
+	mem.Mutex.Lock()
+	for _, duel := range game.Duels {
+		if duel.Truth == "" || duel.Truth != bluffTruths[duel.Question] {
+			mem.Mutex.Unlock()
+			t.Fatalf("duel %q with truth %q", duel.Question, duel.Truth)
+		}
+	}
+	mem.Mutex.Unlock()
+
+	for i, p := range players {
+		for q := 0; q < 2; q++ {
+			question := p.send(mem, RequestParams{Method: "getquestion"})["question"].(string)
+			truth := strings.ToUpper(bluffTruths[question])
+			if resp := p.send(mem, RequestParams{Method: "saveanswer", Answer: " " + truth + " "}); resp["code"] != CodeAnswerIsTruth {
+				t.Fatalf("the true answer as a fake: %v", resp)
+			}
+			if resp := p.send(mem, RequestParams{Method: "saveanswer", Answer: fmt.Sprintf("fake %d %d", i, q)}); resp["status"] != float64(StatusOk) {
+				t.Fatalf("saveanswer: %v", resp)
+			}
+		}
+	}
+	waitPhase(t, mem, game, PhaseVoting)
+
+	// Голосует тот, кто не в дуэли, и находит верный ответ среди трех
+	mem.Mutex.Lock()
+	duel := game.Duels[0]
+	mem.Mutex.Unlock()
+	var voter *testPlayer
+	voterName := ""
+	for i, p := range players {
+		name := fmt.Sprintf("player%d", i)
+		if name != duel.Usernames[0] && name != duel.Usernames[1] {
+			voter, voterName = p, name
+		}
+	}
+	options, _ := voter.send(mem, RequestParams{Method: "getduel"})["answers"].([]any)
+	if len(options) != 3 {
+		t.Fatalf("getduel: %v", options)
+	}
+	vote := -1
+	for i, option := range options {
+		if option == duel.Truth {
+			vote = i
+		}
+	}
+	if vote < 0 {
+		t.Fatalf("no truth %q among %v", duel.Truth, options)
+	}
+	if resp := voter.send(mem, RequestParams{Method: "savevote", Vote: int64(vote)}); resp["status"] != float64(StatusOk) {
+		t.Fatalf("savevote: %v", resp)
+	}
+	mem.Mutex.Lock()
+	defer mem.Mutex.Unlock()
+	points := game.RoundResult[0][voterName]
+	if points != 10 || len(duel.Votes[truthPosConst]) != 1 {
+		t.Fatalf("truth found: %d points, votes %v", points, duel.Votes)
+	}
+}
+
+func TestBluffFooled(t *testing.T) {
+	game := &Game{RoundNum: 1, RoundResult: map[int64]map[string]int64{1: {}}, GameResult: map[string]int64{}}
+	duel := &Duel{
+		Question:  "question",
+		Usernames: []string{"liar", "other"},
+		Answers:   []string{"fake", "another fake"},
+		Votes:     map[int64][]string{},
+		Truth:     "truth",
+	}
+	mode := bluffMode{}
+	mode.PrepareVoting(duel)
+	options := mode.Options(duel)
+	for i, option := range options {
+		if option == "fake" {
+			mode.Vote(game, duel, "voter", int64(i))
+		}
+	}
+	if game.GameResult["liar"] != 20 || game.GameResult["voter"] != 0 || len(duel.Votes[0]) != 1 {
+		t.Fatalf("fooled voter: points %v, votes %v", game.GameResult, duel.Votes)
+	}
+}
+
+func TestRoomMode(t *testing.T) {
+	mem, players := newTestLobby(t, hostLobbyConfig(), 3, 1)
+	host := players[0]
+
+	tests := []struct {
+		params RequestParams
+		field  any
+	}{
+		{RequestParams{Method: "roomsettings", Mode: "poker"}, "mode"},
+		{RequestParams{Method: "roomsettings", Mode: "bluff", Prompts: int64Param(1)}, "prompts"},
+		{RequestParams{Method: "roomsettings", Mode: "bluff"}, nil},
+	}
+	for _, tt := range tests {
+		if resp := host.send(mem, tt.params); resp["field"] != tt.field {
+			t.Fatalf("roomsettings mode %s: %v, want field %v", tt.params.Mode, resp, tt.field)
+		}
+	}
+	mem.Mutex.Lock()
+	mode := mem.Games[0].Mode.Name()
+	mem.Mutex.Unlock()
+	if mode != "bluff" {
+		t.Fatalf("mode %s, want bluff", mode)
+	}
+}
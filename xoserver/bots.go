@@ -0,0 +1,156 @@
+package xoserver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+
+	"github.com/google/uuid"
+
+	"Xo-xo-touch/xoclient"
+)
+
+// Боты сервера занимают места в реванше, которые некому занять. Бот - обычный клиент xoclient,
+// подключенный к серверу через net.Pipe, так что играет по тем же правилам, что и люди.
+
+var botAnswers = []string{
+	"Это было неизбежно",
+	"Спросите у моей бабушки",
+	"Три килограмма огурцов",
+	"Лучше промолчу",
+	"Секретный ингредиент",
+	"Кот, конечно",
+	"Все и сразу",
+	"Ничего, о чем стоит жалеть",
+}
+
+// addBot сажает в комнату бота и возвращает его имя
+func (mem *Memory) addBot(game *Game) string {
+	reqServer, reqBot := net.Pipe()
+	brcastServer, brcastBot := net.Pipe()
+
+	mem.Mutex.Lock()
+	user := mem.idleBot()
+	if user == nil {
+		user = &User{Username: mem.freeBotName(), UserId: uuid.New().String(), Bot: true}
+		mem.Users[user.UserId] = user
+	}
+	session := mem.newSession(user.UserId, reqServer, brcastServer, newClientInfo())
+	mem.Sessions[user.UserId] = session
+	joinGame(game, session)
+	mem.Mutex.Unlock()
+
+	go mem.newClient(reqServer, brcastServer)
+	bot := xoclient.NewClient(reqBot, brcastBot, nil)
+	go runBot(bot, createToken(user.UserId, user.Username), slog.With("bot", user.Username, "game_id", game.GameId))
+	return user.Username
+}
+
+// idleBot - бот, который сейчас не играет, nil, если такого нет. Вызывается под mem.Mutex.
+func (mem *Memory) idleBot() *User {
+	for _, u := range mem.Users {
+		if u.Bot && mem.Sessions[u.UserId] == nil {
+			return u
+		}
+	}
+	return nil
+}
+
+// freeBotName - имя bot-N, которого еще нет. Вызывается под mem.Mutex.
+func (mem *Memory) freeBotName() string {
+	for n := 1; ; n++ {
+		name := fmt.Sprintf("bot-%d", n)
+		taken := false
+		for _, u := range mem.Users {
+			if u.Username == name {
+				taken = true
+				break
+			}
+		}
+		if !taken {
+			return name
+		}
+	}
+}
+
+// runBot отвечает и голосует наугад, пока игра не кончится, и отключается
+func runBot(bot *xoclient.Client, token string, log *slog.Logger) {
+	defer bot.Close()
+	ctx := context.Background()
+	_, err := bot.Hello(ctx)
+	if err != nil {
+		log.Warn("bot hello failed", "err", err)
+		return
+	}
+	bot.SetToken(token)
+
+	for event := range bot.Events() {
+		var act func(context.Context, *xoclient.Client) error
+		switch event.Message {
+		case xoclient.EventGameStarted, xoclient.EventNewRoundStarted:
+			act = botAnswer
+		case xoclient.EventEveryoneAnswered, xoclient.EventNewDuelVotingStarted:
+			act = botVote
+		case xoclient.EventGameEnded, xoclient.EventServerShuttingDown:
+			return
+		default:
+			continue
+		}
+		err = act(ctx, bot)
+		// На паузе бот ждет, пока хозяин продолжит игру, и повторяет запрос
+		for xoclient.ErrorCode(err) == xoclient.CodeGamePaused {
+			if !botWaitResumed(bot) {
+				return
+			}
+			err = act(ctx, bot)
+		}
+		if err != nil {
+			log.Warn("bot request failed", "event", event.Message, "err", err)
+			return
+		}
+	}
+}
+
+// botWaitResumed ждет, пока игру снимут с паузы. false - игра кончилась или сервер закрывается.
+func botWaitResumed(bot *xoclient.Client) bool {
+	for event := range bot.Events() {
+		switch event.Message {
+		case xoclient.EventGameResumed:
+			return true
+		case xoclient.EventGameEnded, xoclient.EventServerShuttingDown:
+			return false
+		}
+	}
+	return false
+}
+
+// botVote голосует наугад за один из вариантов дуэли, в своей дуэли - не голосует
+func botVote(ctx context.Context, bot *xoclient.Client) error {
+	duel, err := bot.GetDuel(ctx)
+	if err != nil {
+		return err
+	}
+	err = bot.SaveVote(ctx, rand.Int63n(int64(len(duel.Answers))))
+	if xoclient.ErrorCode(err) == xoclient.CodeOwnDuel {
+		return nil
+	}
+	return err
+}
+
+func botAnswer(ctx context.Context, bot *xoclient.Client) error {
+	for {
+		_, err := bot.GetQuestion(ctx)
+		if err != nil {
+			return err
+		}
+		resp, err := bot.SaveAnswer(ctx, botAnswers[rand.Intn(len(botAnswers))])
+		if err != nil {
+			return err
+		}
+		if resp.LastAnswer {
+			return nil
+		}
+	}
+}
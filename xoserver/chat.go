@@ -0,0 +1,127 @@
+package xoserver
+
+import (
+	"time"
+)
+
+type HistoryEvent struct {
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"` // chat, reaction, pause, resume
+	Username string    `json:"username"`
+	Text     string    `json:"text"`
+	RoundNum int64     `json:"roundnum"`
+	DuelNum  int64     `json:"duelnum"`
+}
+
+type ResponseChatMessage struct {
+	Message  string `json:"message"`
+	Username string `json:"username"`
+	Text     string `json:"text"`
+}
+
+type ResponseReaction struct {
+	Message  string `json:"message"`
+	Username string `json:"username"`
+	Emoji    string `json:"emoji"`
+	DuelNum  int64  `json:"duelnum"`
+}
+
+var reactionsAllowed = []string{"😂", "🔥", "👍", "👎", "😮", "❤️"}
+
+// chatGame - комната, в чат которой пишет session. Если писать в чат сейчас нельзя,
+// отвечает клиенту ошибкой и возвращает nil.
+func (mem *Memory) chatGame(req *Request, session *Session) *Game {
+	// Нельзя писать, если ты не в комнате
+	// (как часто можно писать, ограничивают лимиты методов sendchat и react)
+	mem.Mutex.Lock()
+	game := mem.Games[session.GameId]
+	mem.Mutex.Unlock()
+	if game == nil {
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeNotInGame, "enter a game first"))
+		return nil
+	}
+	return game
+}
+
+func (mem *Memory) sendChatHandler(req *Request) {
+	session, err := mem.checkToken(req)
+	if err != nil {
+		req.Log.Error("invalid token", "err", err)
+		return
+	}
+
+	mem.Mutex.Lock()
+	username := mem.Users[session.UserId].Username
+	mem.Mutex.Unlock()
+	text, modErr := mem.Moderator.Check(ContentChat, username, req.Params.Text)
+	if modErr != nil {
+		sendError(req, modErr)
+		return
+	}
+	game := mem.chatGame(req, session)
+	if game == nil {
+		return
+	}
+
+	mem.Mutex.Lock()
+	game.History = append(game.History, &HistoryEvent{
+		Time:     mem.Clock.Now(),
+		Type:     "chat",
+		Username: username,
+		Text:     text,
+		RoundNum: game.RoundNum,
+		DuelNum:  game.DuelNum,
+	})
+	mem.Mutex.Unlock()
+	req.Log.Debug("chat message", "username", username, "text", text)
+
+	sendStatus(req, StatusOk)
+	mem.sendGameBroadcast(game, &ResponseChatMessage{Message: "chat", Username: username, Text: text})
+}
+
+func (mem *Memory) reactHandler(req *Request) {
+	session, err := mem.checkToken(req)
+	if err != nil {
+		req.Log.Error("invalid token", "err", err)
+		return
+	}
+
+	emoji := req.Params.Emoji
+	emojiAllowed := false
+	for _, e := range reactionsAllowed {
+		if e == emoji {
+			emojiAllowed = true
+			break
+		}
+	}
+	if !emojiAllowed {
+		sendError(req, newError(ErrNotAcceptable, CodeEmojiNotAllowed, "emoji %s is not allowed", emoji))
+		return
+	}
+	game := mem.chatGame(req, session)
+	if game == nil {
+		return
+	}
+
+	mem.Mutex.Lock()
+	// Реагировать можно только на дуэль, которую сейчас показывают
+	if !game.EveryoneAnswered || game.DuelNum == game.MaxUsersCnt {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeNotVoting, "reactions are allowed only while a duel is shown"))
+		return
+	}
+	username := mem.Users[session.UserId].Username
+	duelNum := game.DuelNum
+	game.History = append(game.History, &HistoryEvent{
+		Time:     mem.Clock.Now(),
+		Type:     "reaction",
+		Username: username,
+		Text:     emoji,
+		RoundNum: game.RoundNum,
+		DuelNum:  duelNum,
+	})
+	mem.Mutex.Unlock()
+
+	sendStatus(req, StatusOk)
+	mem.sendGameBroadcast(game, &ResponseReaction{Message: "reaction", Username: username, Emoji: emoji, DuelNum: duelNum})
+}
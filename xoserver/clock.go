@@ -0,0 +1,40 @@
+package xoserver
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock - время игры: паузы между фазами и отметки времени в истории.
+// Сетевые таймауты и лимиты запросов идут по настоящему времени.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time        { return time.Now() }
+func (realClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// FakeClock - часы для тестов: Sleep не ждет, а сразу переводит время вперед
+type FakeClock struct {
+	Mutex *sync.Mutex
+	Time  time.Time
+}
+
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{Mutex: &sync.Mutex{}, Time: t}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	return c.Time
+}
+
+func (c *FakeClock) Sleep(d time.Duration) {
+	c.Mutex.Lock()
+	c.Time = c.Time.Add(d)
+	c.Mutex.Unlock()
+}
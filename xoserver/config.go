@@ -0,0 +1,372 @@
+package xoserver
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
+
+type OutboxConfig struct {
+	QueueLen     int64              `json:"queuelen"`
+	WriteTimeout float64            `json:"writetimeout"` // seconds
+	Policy       SlowConsumerPolicy `json:"policy"`
+}
+
+// Config - настройки сервера. Порядок: значения по умолчанию, файл, переменные окружения, флаги.
+// По SIGHUP все, кроме портов и адресов, перечитывается без перезапуска.
+type Config struct {
+	PortReq             int64                          `json:"portreq"`
+	PortBrcast          int64                          `json:"portbrcast"`
+	MaxUsersCnt         int64                          `json:"maxuserscnt"`
+	MaxRoundsCnt        int64                          `json:"maxroundscnt"`
+	SleepBetween        float64                        `json:"sleepbetween"` // seconds
+	StartDelay          float64                        `json:"startdelay"`   // seconds
+	PrintRequestsToSend bool                           `json:"printrequeststosend"`
+	BannedWordsFile     string                         `json:"bannedwordsfile"`
+	Moderation          map[ContentKind]ModerationRule `json:"moderation"`
+	RateLimits          RateLimitConfig                `json:"ratelimits"`
+	Outbox              OutboxConfig                   `json:"outbox"`
+	LogLevel            string                         `json:"loglevel"`      // debug, info, warn, error
+	LogFormat           string                         `json:"logformat"`     // text, json
+	HttpAddr            string                         `json:"httpaddr"`      // /metrics, пусто - выключено
+	AdminToken          string                         `json:"admintoken"`    // Bearer-токен для /moderation/flags, пусто - выключено
+	StateFile           string                         `json:"statefile"`     // пусто - ничего не сохранять
+	ShutdownGrace       float64                        `json:"shutdowngrace"` // seconds
+	TlsCertFile         string                         `json:"tlscertfile"`   // пусто - без TLS
+	TlsKeyFile          string                         `json:"tlskeyfile"`
+	MinProtocolVersion  int64                          `json:"minprotocolversion"` // клиенты старше отклоняются; 1 - и без hello
+	PlayerPrompts       int64                          `json:"playerprompts"`      // вопросов от каждого игрока в комнате, 0 - только пакет
+	RematchWait         float64                        `json:"rematchwait"`        // seconds, сколько ждать голосов за реванш; 0 - без реванша
+	Teams               int64                          `json:"teams"`              // команд в комнате, 0 - каждый сам за себя
+	Mode                string                         `json:"mode"`               // режим игры: classic, bluff
+}
+
+func DefaultConfig() *Config {
+	rateLimits := defaultRateLimitConfig
+	rateLimits.Methods = map[string]RateLimit{}
+	for method, l := range defaultRateLimitConfig.Methods {
+		rateLimits.Methods[method] = l
+	}
+	return &Config{
+		PortReq:             portReqConst,
+		PortBrcast:          portBrcastConst,
+		MaxUsersCnt:         maxUsersCntConst,
+		MaxRoundsCnt:        maxRoundsCntConst,
+		SleepBetween:        sleepBetweenConst,
+		StartDelay:          startDelayConst,
+		PrintRequestsToSend: printRequestsToSendConst,
+		BannedWordsFile:     bannedWordsFileConst,
+		Moderation:          map[ContentKind]ModerationRule{},
+		RateLimits:          rateLimits,
+		Outbox: OutboxConfig{
+			QueueLen:     outboxQueueLenConst,
+			WriteTimeout: writeTimeoutConst,
+			Policy:       slowConsumerPolicyConst,
+		},
+		LogLevel:      logLevelConst,
+		LogFormat:     logFormatConst,
+		HttpAddr:      httpAddrConst,
+		StateFile:     stateFileConst,
+		ShutdownGrace: shutdownGraceConst,
+
+		MinProtocolVersion: legacyProtocolVersion,
+		PlayerPrompts:      playerPromptsConst,
+		RematchWait:        rematchWaitConst,
+		Teams:              teamsConst,
+		Mode:               gameModeConst,
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// configOption - настройка, которую можно задать флагом или переменной окружения
+type configOption struct {
+	Flag  string
+	Env   string
+	Usage string
+	Set   func(c *Config, v string) error
+}
+
+func intOption(field func(c *Config) *int64) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func floatOption(field func(c *Config) *float64) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+var configOptions = []configOption{
+	{"portreq", "XOXO_PORT_REQ", "port for requests", intOption(func(c *Config) *int64 { return &c.PortReq })},
+	{"portbrcast", "XOXO_PORT_BRCAST", "port for broadcasts", intOption(func(c *Config) *int64 { return &c.PortBrcast })},
+	{"maxusers", "XOXO_MAX_USERS", "players in a room", intOption(func(c *Config) *int64 { return &c.MaxUsersCnt })},
+	{"maxrounds", "XOXO_MAX_ROUNDS", "rounds in a game", intOption(func(c *Config) *int64 { return &c.MaxRoundsCnt })},
+	{"sleepbetween", "XOXO_SLEEP_BETWEEN", "pause between duels and rounds, seconds", floatOption(func(c *Config) *float64 { return &c.SleepBetween })},
+	{"startdelay", "XOXO_START_DELAY", "pause before the game starts, seconds", floatOption(func(c *Config) *float64 { return &c.StartDelay })},
+	{"printrequests", "XOXO_PRINT_REQUESTS", "print requests to send for every registered user", func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		c.PrintRequestsToSend = b
+		return err
+	}},
+	{"bannedwords", "XOXO_BANNED_WORDS_FILE", "file with banned words", func(c *Config, v string) error {
+		c.BannedWordsFile = v
+		return nil
+	}},
+	{"loglevel", "XOXO_LOG_LEVEL", "log level: debug, info, warn, error", func(c *Config, v string) error {
+		c.LogLevel = v
+		return nil
+	}},
+	{"logformat", "XOXO_LOG_FORMAT", "log format: text, json", func(c *Config, v string) error {
+		c.LogFormat = v
+		return nil
+	}},
+	{"statefile", "XOXO_STATE_FILE", "file to keep registered users in, empty to disable", func(c *Config, v string) error {
+		c.StateFile = v
+		return nil
+	}},
+	{"shutdowngrace", "XOXO_SHUTDOWN_GRACE", "how long running games may last after SIGTERM, seconds", floatOption(func(c *Config) *float64 { return &c.ShutdownGrace })},
+	{"tlscert", "XOXO_TLS_CERT", "TLS certificate file (pem) for the game ports, empty for plain TCP", func(c *Config, v string) error {
+		c.TlsCertFile = v
+		return nil
+	}},
+	{"tlskey", "XOXO_TLS_KEY", "TLS private key file (pem) for the game ports", func(c *Config, v string) error {
+		c.TlsKeyFile = v
+		return nil
+	}},
+	{"playerprompts", "XOXO_PLAYER_PROMPTS", "prompts each player may send while the room fills up, 0 for pack prompts only", intOption(func(c *Config) *int64 { return &c.PlayerPrompts })},
+	{"rematchwait", "XOXO_REMATCH_WAIT", "how long to wait for playagain votes after a game, seconds, 0 to disable rematches", floatOption(func(c *Config) *float64 { return &c.RematchWait })},
+	{"mode", "XOXO_MODE", "game mode: classic, or bluff to find the true answer among fake ones", func(c *Config, v string) error {
+		c.Mode = v
+		return nil
+	}},
+	{"teams", "XOXO_TEAMS", "teams in a room, 0 for everyone on their own", intOption(func(c *Config) *int64 { return &c.Teams })},
+	{"minprotocol", "XOXO_MIN_PROTOCOL", "oldest protocol version of clients to accept, 1 accepts clients without hello", intOption(func(c *Config) *int64 { return &c.MinProtocolVersion })},
+	{"httpaddr", "XOXO_HTTP_ADDR", "address of the http server with /metrics, empty to disable", func(c *Config, v string) error {
+		c.HttpAddr = v
+		return nil
+	}},
+	{"admintoken", "XOXO_ADMIN_TOKEN", "bearer token for /moderation/flags, empty to disable it", func(c *Config, v string) error {
+		c.AdminToken = v
+		return nil
+	}},
+}
+
+// ConfigLoader помнит, откуда брать настройки, чтобы перечитать их по SIGHUP
+type ConfigLoader struct {
+	Path  string
+	Flags map[string]string // flag -> value, только явно заданные
+}
+
+func NewConfigLoader(args []string) (*ConfigLoader, error) {
+	loader := &ConfigLoader{
+		Path:  os.Getenv("XOXO_CONFIG"),
+		Flags: map[string]string{},
+	}
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.StringVar(&loader.Path, "config", loader.Path, "config file (json), env XOXO_CONFIG")
+	for _, opt := range configOptions {
+		name := opt.Flag
+		fs.Func(name, opt.Usage+", env "+opt.Env, func(v string) error {
+			loader.Flags[name] = v
+			return nil
+		})
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	return loader, nil
+}
+
+func (loader *ConfigLoader) Load() (*Config, error) {
+	config := DefaultConfig()
+
+	if loader.Path != "" {
+		data, err := os.ReadFile(loader.Path)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(data, config)
+		if err != nil {
+			return nil, fmt.Errorf("config %s: %w", loader.Path, err)
+		}
+	}
+
+	for _, opt := range configOptions {
+		v, ok := os.LookupEnv(opt.Env)
+		if !ok {
+			continue
+		}
+		err := opt.Set(config, v)
+		if err != nil {
+			return nil, fmt.Errorf("env %s: %w", opt.Env, err)
+		}
+	}
+
+	for _, opt := range configOptions {
+		v, ok := loader.Flags[opt.Flag]
+		if !ok {
+			continue
+		}
+		err := opt.Set(config, v)
+		if err != nil {
+			return nil, fmt.Errorf("flag -%s: %w", opt.Flag, err)
+		}
+	}
+
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (c *Config) Validate() error {
+	errs := []error{}
+	// 0 - любой свободный порт
+	if c.PortReq < 0 || c.PortReq > 65535 {
+		errs = append(errs, fmt.Errorf("portreq %d is out of range", c.PortReq))
+	}
+	if c.PortBrcast < 0 || c.PortBrcast > 65535 {
+		errs = append(errs, fmt.Errorf("portbrcast %d is out of range", c.PortBrcast))
+	}
+	if c.PortReq != 0 && c.PortReq == c.PortBrcast {
+		errs = append(errs, fmt.Errorf("portreq and portbrcast are both %d", c.PortReq))
+	}
+	if (c.TlsCertFile == "") != (c.TlsKeyFile == "") {
+		errs = append(errs, errors.New("tlscertfile and tlskeyfile must be set together"))
+	}
+	if c.MaxUsersCnt < minUsersCntConst {
+		errs = append(errs, fmt.Errorf("maxuserscnt must be at least %d, got %d", minUsersCntConst, c.MaxUsersCnt))
+	}
+	if c.MaxRoundsCnt < 1 {
+		errs = append(errs, fmt.Errorf("maxroundscnt must be at least 1, got %d", c.MaxRoundsCnt))
+	}
+	// Каждому игроку в раунде нужен свой вопрос
+	if c.MaxUsersCnt > int64(len(questions)) {
+		errs = append(errs, fmt.Errorf("%d players need %d questions per round, there are only %d",
+			c.MaxUsersCnt, c.MaxUsersCnt, len(questions)))
+	}
+	if c.SleepBetween < 0 || c.StartDelay < 0 || c.ShutdownGrace < 0 {
+		errs = append(errs, fmt.Errorf("sleepbetween, startdelay and shutdowngrace must not be negative"))
+	}
+	for kind, rule := range c.Moderation {
+		if rule.Action != ActionBlock && rule.Action != ActionMask && rule.Action != ActionFlag {
+			errs = append(errs, fmt.Errorf("moderation %s: unknown action %q", kind, rule.Action))
+		}
+		if rule.MaxLen < rule.MinLen {
+			errs = append(errs, fmt.Errorf("moderation %s: maxlen is less than minlen", kind))
+		}
+	}
+	limits := []RateLimit{c.RateLimits.Connection, c.RateLimits.Ip}
+	for _, l := range c.RateLimits.Methods {
+		limits = append(limits, l)
+	}
+	for _, l := range limits {
+		if l.Rate < 0 || l.Burst < 0 || (l.Rate > 0 && l.Burst < 1) {
+			errs = append(errs, fmt.Errorf("rate limit %+v: rate and burst must not be negative, burst must be at least 1", l))
+			break
+		}
+	}
+	if c.RateLimits.MaxInFlight < 1 || c.RateLimits.MaxLineLen < 64 {
+		errs = append(errs, fmt.Errorf("ratelimits: maxinflight must be at least 1 and maxlinelen at least 64"))
+	}
+	if c.Outbox.QueueLen < 1 || c.Outbox.WriteTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("outbox: queuelen and writetimeout must be positive"))
+	}
+	if c.Outbox.Policy != PolicyDrop && c.Outbox.Policy != PolicyLatest && c.Outbox.Policy != PolicyDisconnect {
+		errs = append(errs, fmt.Errorf("outbox: unknown policy %q", c.Outbox.Policy))
+	}
+	_, err := parseLogLevel(c.LogLevel)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("loglevel: %w", err))
+	}
+	if c.MinProtocolVersion < legacyProtocolVersion || c.MinProtocolVersion > ProtocolVersion {
+		errs = append(errs, fmt.Errorf("minprotocolversion must be from %d to %d", legacyProtocolVersion, ProtocolVersion))
+	}
+	if c.PlayerPrompts < 0 || c.PlayerPrompts > maxPlayerPromptsConst {
+		errs = append(errs, fmt.Errorf("playerprompts must be from 0 to %d, got %d", maxPlayerPromptsConst, c.PlayerPrompts))
+	}
+	if c.RematchWait < 0 {
+		errs = append(errs, fmt.Errorf("rematchwait must not be negative, got %v", c.RematchWait))
+	}
+	if c.Teams == 1 || c.Teams < 0 || c.Teams > int64(len(teamNames)) {
+		errs = append(errs, fmt.Errorf("teams must be 0 or from 2 to %d, got %d", len(teamNames), c.Teams))
+	} else if c.Teams > 0 && checkTeams(c.Teams, c.MaxUsersCnt) != nil {
+		errs = append(errs, fmt.Errorf("teams: %d players can not be split into %d equal teams of a %d to %d player game", c.MaxUsersCnt, c.Teams, minTeamUsersConst, maxTeamUsersConst))
+	}
+	if gameModes[c.Mode] == nil {
+		errs = append(errs, fmt.Errorf("unknown mode %q", c.Mode))
+	} else if c.Mode == "bluff" && c.PlayerPrompts > 0 {
+		errs = append(errs, fmt.Errorf("bluff mode plays pack prompts only, playerprompts must be 0"))
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		errs = append(errs, fmt.Errorf("logformat must be text or json, got %q", c.LogFormat))
+	}
+	return errors.Join(errs...)
+}
+
+func (mem *Memory) config() *Config {
+	return mem.Config.Load()
+}
+
+// applyConfig включает новые настройки. Порты меняются только перезапуском.
+func (mem *Memory) applyConfig(config *Config) {
+	old := mem.Config.Load()
+	if old != nil && (old.PortReq != config.PortReq || old.PortBrcast != config.PortBrcast || old.HttpAddr != config.HttpAddr || old.StateFile != config.StateFile ||
+		old.TlsCertFile != config.TlsCertFile || old.TlsKeyFile != config.TlsKeyFile) {
+		slog.Warn("ports and files can not be changed without a restart",
+			"portreq", old.PortReq, "portbrcast", old.PortBrcast, "httpaddr", old.HttpAddr, "statefile", old.StateFile,
+			"tlscertfile", old.TlsCertFile, "tlskeyfile", old.TlsKeyFile)
+		config.PortReq = old.PortReq
+		config.PortBrcast = old.PortBrcast
+		config.HttpAddr = old.HttpAddr
+		config.StateFile = old.StateFile
+		config.TlsCertFile = old.TlsCertFile
+		config.TlsKeyFile = old.TlsKeyFile
+	}
+
+	bannedWords := defaultBannedWords
+	if config.BannedWordsFile != "" {
+		words, err := loadWordList(config.BannedWordsFile)
+		if err != nil {
+			slog.Warn("banned words are not loaded, using defaults", "file", config.BannedWordsFile, "err", err)
+		} else {
+			bannedWords = words
+		}
+	}
+
+	if mem.Moderator == nil {
+		mem.Moderator = newModerator(bannedWords, config.Moderation)
+	} else {
+		mem.Moderator.Update(bannedWords, config.Moderation)
+	}
+	if mem.Limiter == nil {
+		mem.Limiter = newRateLimiter(config.RateLimits)
+	} else {
+		mem.Limiter.SetConfig(config.RateLimits)
+	}
+	level, _ := parseLogLevel(config.LogLevel)
+	logLevel.Set(level)
+	mem.Config.Store(config)
+}
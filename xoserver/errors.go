@@ -0,0 +1,80 @@
+package xoserver
+
+import (
+	"fmt"
+
+	"Xo-xo-touch/xoclient"
+)
+
+// Коды ошибок объявлены один раз, в xoclient: по ним клиент решает, что делать.
+// Здесь только короткие имена для обработчиков сервера.
+const (
+	CodeInvalidRequest      = xoclient.CodeInvalidRequest
+	CodeUnknownMethod       = xoclient.CodeUnknownMethod
+	CodeRequestTooLarge     = xoclient.CodeRequestTooLarge
+	CodeRateLimited         = xoclient.CodeRateLimited
+	CodeUpgradeRequired     = xoclient.CodeUpgradeRequired
+	CodeServerShuttingDown  = xoclient.CodeServerShuttingDown
+	CodeUsernameTaken       = xoclient.CodeUsernameTaken
+	CodeWrongCredentials    = xoclient.CodeWrongCredentials
+	CodeAlreadyLoggedIn     = xoclient.CodeAlreadyLoggedIn
+	CodeInvalidToken        = xoclient.CodeInvalidToken
+	CodeUnknownUser         = xoclient.CodeUnknownUser
+	CodeTextTooShort        = xoclient.CodeTextTooShort
+	CodeTextTooLong         = xoclient.CodeTextTooLong
+	CodeTextRejected        = xoclient.CodeTextRejected
+	CodeEmojiNotAllowed     = xoclient.CodeEmojiNotAllowed
+	CodeNotInGame           = xoclient.CodeNotInGame
+	CodeGameNotStarted      = xoclient.CodeGameNotStarted
+	CodeAlreadyAnswered     = xoclient.CodeAlreadyAnswered
+	CodeAlreadyVoted        = xoclient.CodeAlreadyVoted
+	CodeNotEveryoneAnswered = xoclient.CodeNotEveryoneAnswered
+	CodeVotingOver          = xoclient.CodeVotingOver
+	CodeNotVoting           = xoclient.CodeNotVoting
+	CodeOwnDuel             = xoclient.CodeOwnDuel
+	CodeNoDuelResult        = xoclient.CodeNoDuelResult
+	CodePromptsDisabled     = xoclient.CodePromptsDisabled
+	CodePromptsClosed       = xoclient.CodePromptsClosed
+	CodeTooManyPrompts      = xoclient.CodeTooManyPrompts
+	CodeGameNotEnded        = xoclient.CodeGameNotEnded
+	CodeRematchOver         = xoclient.CodeRematchOver
+	CodeNotHost             = xoclient.CodeNotHost
+	CodeNotInLobby          = xoclient.CodeNotInLobby
+	CodeNoSuchPlayer        = xoclient.CodeNoSuchPlayer
+	CodeKicked              = xoclient.CodeKicked
+	CodeNotEnoughPlayers    = xoclient.CodeNotEnoughPlayers
+	CodeGamePaused          = xoclient.CodeGamePaused
+	CodeNotPaused           = xoclient.CodeNotPaused
+	CodeGameEnded           = xoclient.CodeGameEnded
+	CodeTeamsDisabled       = xoclient.CodeTeamsDisabled
+	CodeTeamFull            = xoclient.CodeTeamFull
+	CodeUnevenTeams         = xoclient.CodeUnevenTeams
+	CodeAnswerIsTruth       = xoclient.CodeAnswerIsTruth
+)
+
+// ResponseError - ответ на любой неудачный запрос
+type ResponseError struct {
+	Status  int64  `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Method  string `json:"method"`
+	Field   string `json:"field,omitempty"` // поле запроса, если ошибка в нем
+}
+
+func newError(status int64, code string, format string, args ...any) *ResponseError {
+	return &ResponseError{Status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func sendError(req *Request, e *ResponseError) {
+	resp := *e
+	resp.Method = req.Method
+	req.Log.Info("request rejected", "status", resp.Status, "code", resp.Code, "field", resp.Field, "message", resp.Message)
+	sendData, err := req.Codec.Marshal(&resp)
+	if err != nil {
+		req.Log.Error("marshal response", "err", err)
+	}
+	_, err = req.ConnReq.Write(sendData)
+	if err != nil {
+		req.Log.Error("write response", "err", err)
+	}
+}
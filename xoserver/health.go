@@ -0,0 +1,93 @@
+package xoserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// Задаются программой сервера, а ей - при сборке: go build -ldflags "-X main.version=1.2.3 -X main.commit=abc123"
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+var startedAt = time.Now()
+
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	GoVersion string `json:"goversion"`
+}
+
+type ResponseHealth struct {
+	Status string            `json:"status"`
+	Uptime float64           `json:"uptime"` // seconds
+	Build  BuildInfo         `json:"build"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func buildInfo() BuildInfo {
+	info := BuildInfo{Version: Version, Commit: Commit, GoVersion: runtime.Version()}
+	if info.Commit == "" {
+		if bi, ok := debug.ReadBuildInfo(); ok {
+			for _, s := range bi.Settings {
+				if s.Key == "vcs.revision" {
+					info.Commit = s.Value
+				}
+			}
+		}
+	}
+	return info
+}
+
+// Check проверяет, что в каталог хранилища можно писать
+func (st *Store) Check() error {
+	if st.Path == "" {
+		return nil
+	}
+	f, err := os.CreateTemp(filepath.Dir(st.Path), ".xoxo-check-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func writeHealth(w http.ResponseWriter, code int, health *ResponseHealth) {
+	health.Uptime = time.Since(startedAt).Seconds()
+	health.Build = buildInfo()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(health)
+}
+
+// healthzHandler - процесс жив и отвечает
+func (mem *Memory) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, &ResponseHealth{Status: "ok"})
+}
+
+// readyzHandler - сервер принимает игроков: не останавливается и может сохранять состояние
+func (mem *Memory) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{"draining": "ok", "storage": "ok"}
+	ready := true
+	if mem.Draining.Load() {
+		checks["draining"] = "server is shutting down"
+		ready = false
+	}
+	err := mem.Store.Check()
+	if err != nil {
+		checks["storage"] = err.Error()
+		ready = false
+	}
+
+	if !ready {
+		writeHealth(w, http.StatusServiceUnavailable, &ResponseHealth{Status: "unavailable", Checks: checks})
+		return
+	}
+	writeHealth(w, http.StatusOK, &ResponseHealth{Status: "ok", Checks: checks})
+}
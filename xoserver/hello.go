@@ -0,0 +1,122 @@
+package xoserver
+
+import (
+	"sync"
+
+	"Xo-xo-touch/xocodec"
+)
+
+// Версии протокола:
+//   - 1 - клиент не шлет hello, ошибки приходят одним статусом;
+//   - 2 - hello, строгая проверка запросов, ошибки с code, message и method, duelnum в getduel.
+//
+// Новая версия нужна, когда меняется то, что старый клиент не сможет разобрать:
+// поля ответов, строки рассылок, смысл статусов.
+const (
+	ProtocolVersion       = 2
+	legacyProtocolVersion = 1 // так считается клиент, который не прислал hello
+)
+
+// serverFeatures - что умеет сервер. Клиент показывает только то, что есть в списке.
+var serverFeatures = []string{"chat", "reactions", "errorcodes", "msgpack", "prompts", "rematch", "host", "pause", "teams", "bluff"}
+
+// ClientInfo - что клиент сообщил о себе в hello. Одно на соединение.
+type ClientInfo struct {
+	Mutex        *sync.Mutex
+	Version      int64
+	Capabilities []string
+	Codec        xocodec.Codec // в чем слать ответы и рассылки, до hello - JSON
+}
+
+func newClientInfo() *ClientInfo {
+	return &ClientInfo{Mutex: &sync.Mutex{}, Version: legacyProtocolVersion, Capabilities: []string{}, Codec: xocodec.JSON}
+}
+
+func (c *ClientInfo) version() int64 {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	return c.Version
+}
+
+func (c *ClientInfo) codec() xocodec.Codec {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	return c.Codec
+}
+
+// chooseCodec - кодировка для клиента с такими возможностями: MessagePack, если клиент его умеет
+func chooseCodec(capabilities []string) xocodec.Codec {
+	for _, c := range capabilities {
+		if c == xocodec.Msgpack.Name() {
+			return xocodec.Msgpack
+		}
+	}
+	return xocodec.JSON
+}
+
+type ResponseHello struct {
+	Status     int64    `json:"status"`
+	Version    int64    `json:"version"`    // версия протокола сервера
+	MinVersion int64    `json:"minversion"` // клиенты старше этой версии отклоняются
+	Server     string   `json:"server"`     // версия сборки сервера
+	Features   []string `json:"features"`
+	Encoding   string   `json:"encoding"` // в чем сервер пишет начиная со следующего ответа
+}
+
+// helloHandler запоминает версию клиента и отвечает своей. Клиент новее сервера принимается:
+// он сам должен перейти на версию сервера или отключиться.
+func (mem *Memory) helloHandler(req *Request) {
+	minVersion := mem.config().MinProtocolVersion
+	if req.Params.Version < minVersion {
+		req.Log.Warn("client is too old", "version", req.Params.Version, "minversion", minVersion)
+		sendError(req, newError(ErrUpgradeRequired, CodeUpgradeRequired,
+			"protocol version %d is not supported, the server needs %d or newer: upgrade the client", req.Params.Version, minVersion))
+		return
+	}
+
+	// Сам ответ на hello еще в прежней кодировке: req.Codec запомнен при получении запроса
+	codec := chooseCodec(req.Params.Capabilities)
+	req.Client.Mutex.Lock()
+	req.Client.Version = req.Params.Version
+	req.Client.Capabilities = req.Params.Capabilities
+	req.Client.Codec = codec
+	req.Client.Mutex.Unlock()
+	req.Log.Info("hello", "version", req.Params.Version, "capabilities", req.Params.Capabilities, "encoding", codec.Name())
+
+	sendData, err := req.Codec.Marshal(&ResponseHello{
+		Status:     StatusOk,
+		Version:    ProtocolVersion,
+		MinVersion: minVersion,
+		Server:     Version,
+		Features:   serverFeatures,
+		Encoding:   codec.Name(),
+	})
+	if err != nil {
+		req.Log.Error("marshal response", "err", err)
+	}
+	_, err = req.ConnReq.Write(sendData)
+	if err != nil {
+		req.Log.Error("write response", "err", err)
+	}
+}
+
+// checkProtocol отклоняет запросы клиентов, чья версия протокола меньше MinProtocolVersion.
+// Hello проходит всегда, иначе клиенту не сообщить свою версию.
+func (mem *Memory) checkProtocol(req *Request) bool {
+	if req.Method == "hello" {
+		return true
+	}
+	minVersion := mem.config().MinProtocolVersion
+	version := req.Client.version()
+	if version >= minVersion {
+		return true
+	}
+	if version == legacyProtocolVersion {
+		sendError(req, newError(ErrUpgradeRequired, CodeUpgradeRequired,
+			"send hello with protocol version %d or newer first: upgrade the client", minVersion))
+	} else {
+		sendError(req, newError(ErrUpgradeRequired, CodeUpgradeRequired,
+			"protocol version %d is not supported, the server needs %d or newer: upgrade the client", version, minVersion))
+	}
+	return false
+}
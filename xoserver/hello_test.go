@@ -0,0 +1,101 @@
+package xoserver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"Xo-xo-touch/xocodec"
+)
+
+func TestHello(t *testing.T) {
+	config := testConfig()
+	config.MinProtocolVersion = 2
+	mem := newTestMemory(t, config)
+	p := newTestPlayer()
+
+	// Без hello клиент считается клиентом версии 1
+	resp := p.call(mem, `{"method": "register", "username": "player", "password": "password"}`)
+	if resp[0]["code"] != CodeUpgradeRequired {
+		t.Fatalf("request before hello: %v", resp)
+	}
+	resp = p.call(mem, `{"method": "hello", "version": 1}`)
+	if resp[0]["code"] != CodeUpgradeRequired || resp[0]["method"] != "hello" {
+		t.Fatalf("hello with an old version: %v", resp)
+	}
+
+	resp = p.call(mem, `{"method": "hello", "version": 2, "capabilities": ["chat"]}`)
+	if resp[0]["status"] != float64(StatusOk) || resp[0]["version"] != float64(ProtocolVersion) || resp[0]["minversion"] != float64(2) {
+		t.Fatalf("hello: %v", resp)
+	}
+	features, _ := resp[0]["features"].([]any)
+	if len(features) != len(serverFeatures) {
+		t.Fatalf("hello features: %v", resp)
+	}
+	resp = p.call(mem, `{"method": "register", "username": "player", "password": "password"}`)
+	if resp[0]["status"] != float64(StatusOk) {
+		t.Fatalf("request after hello: %v", resp)
+	}
+
+	// Клиент новее сервера принимается, он сам перейдет на версию сервера
+	resp = newTestPlayer().call(mem, `{"method": "hello", "version": 100}`)
+	if resp[0]["status"] != float64(StatusOk) || resp[0]["version"] != float64(ProtocolVersion) {
+		t.Fatalf("hello from a newer client: %v", resp)
+	}
+}
+
+func TestHelloMsgpack(t *testing.T) {
+	mem := newTestMemory(t, testConfig())
+	p := newTestPlayer()
+
+	// Ответ на hello еще в JSON: клиент узнает о MessagePack только из него
+	resp := p.call(mem, `{"method": "hello", "version": 2, "capabilities": ["msgpack"]}`)
+	if resp[0]["encoding"] != "msgpack" || p.Last[0] != '{' {
+		t.Fatalf("hello: %s", p.Last)
+	}
+	resp = p.call(mem, `{"method": "register", "username": "player", "password": "password"}`)
+	if resp[0]["status"] != float64(StatusOk) || !xocodec.IsMsgpack(p.Last[0]) {
+		t.Fatalf("register after hello: %v, %x", resp, p.Last)
+	}
+	resp = p.call(mem, `{"method": "nosuchmethod"}`)
+	if resp[0]["code"] != CodeUnknownMethod || !xocodec.IsMsgpack(p.Last[0]) {
+		t.Fatalf("error after hello: %v, %x", resp, p.Last)
+	}
+
+	// Без msgpack в возможностях остается JSON
+	other := newTestPlayer()
+	resp = other.call(mem, `{"method": "hello", "version": 2, "capabilities": ["chat"]}`)
+	if resp[0]["encoding"] != "json" {
+		t.Fatalf("hello without msgpack: %v", resp)
+	}
+	other.call(mem, `{"method": "register", "username": "other", "password": "password"}`)
+	if other.Last[0] != '{' {
+		t.Fatalf("register without msgpack: %s", other.Last)
+	}
+}
+
+func TestReadRequest(t *testing.T) {
+	hello, _ := xocodec.Msgpack.Marshal(map[string]any{"method": "hello", "version": 2})
+	stream := `{"method": "getduel"}` + "\r\n" + string(hello) + "\n" + `{"method": "react"}`
+	reader := bufio.NewReader(strings.NewReader(stream))
+	// Пустая строка между MessagePack и JSON - тоже запрос, на нее сервер ответит ошибкой
+	want := []string{`{"method": "getduel"}`, `{"method":"hello","version":2}`, ``, `{"method": "react"}`}
+	for _, w := range want {
+		data, err := readRequest(reader, 64)
+		if err != nil || string(data) != w {
+			t.Fatalf("got %q, %v, want %q", data, err, w)
+		}
+	}
+
+	tooLong := strings.Repeat("x", 100) + "\n"
+	_, err := readRequest(bufio.NewReader(strings.NewReader(tooLong)), 64)
+	if !errors.Is(err, xocodec.ErrTooLarge) {
+		t.Fatalf("too long line: %v", err)
+	}
+	_, err = readRequest(bufio.NewReader(bytes.NewReader([]byte{0x81, 0x01, 0x01})), 64)
+	if !errors.Is(err, xocodec.ErrInvalidMsgpack) {
+		t.Fatalf("invalid msgpack: %v", err)
+	}
+}
@@ -0,0 +1,254 @@
+package xoserver
+
+// Хозяин комнаты - первый вошедший. Пока комната собирается, он меняет ее настройки, выгоняет игроков
+// и может начать игру, не дожидаясь, пока комната заполнится. Если хозяин отключился,
+// роль переходит к тому, кто дольше всех в комнате.
+
+type ResponseNewHost struct {
+	Message  string `json:"message"`
+	Username string `json:"username"`
+}
+
+type ResponseKicked struct {
+	Message  string `json:"message"`
+	Username string `json:"username"`
+}
+
+type ResponseRoomSettings struct {
+	Message   string `json:"message"`
+	MaxUsers  int64  `json:"maxusers"`
+	MaxRounds int64  `json:"maxrounds"`
+	Prompts   int64  `json:"prompts"`
+	Teams     int64  `json:"teams"`
+	Mode      string `json:"mode"`
+}
+
+// hostGame - комната, хозяин которой session. Иначе отвечает ошибкой и возвращает nil.
+func (mem *Memory) hostGame(req *Request, session *Session) *Game {
+	mem.Mutex.Lock()
+	game := mem.Games[session.GameId]
+	isHost := game != nil && game.HostId == session.UserId
+	mem.Mutex.Unlock()
+	if game == nil {
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeNotInGame, "enter a game first"))
+		return nil
+	}
+	if !isHost {
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeNotHost, "only the host can do this"))
+		return nil
+	}
+	return game
+}
+
+// errGameStarted - ответ хозяину, который меняет комнату после начала игры.
+// Фазу проверяют под тем же mem.Mutex, что и само изменение, иначе игра может начаться между ними.
+func errGameStarted() *ResponseError {
+	return newError(ErrMethodIsNotAllowed, CodeNotInLobby, "the game has already started")
+}
+
+func (mem *Memory) kickHandler(req *Request) {
+	session, err := mem.checkToken(req)
+	if err != nil {
+		req.Log.Error("invalid token", "err", err)
+		return
+	}
+	game := mem.hostGame(req, session)
+	if game == nil {
+		return
+	}
+
+	mem.Mutex.Lock()
+	if game.Phase != PhaseLobby {
+		mem.Mutex.Unlock()
+		sendError(req, errGameStarted())
+		return
+	}
+	kickedId := ""
+	for userId := range game.Sessions {
+		if mem.Users[userId].Username == req.Params.Username {
+			kickedId = userId
+		}
+	}
+	if kickedId == "" {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrNotAcceptable, CodeNoSuchPlayer, "%s is not in the room", req.Params.Username))
+		return
+	}
+	if kickedId == session.UserId {
+		mem.Mutex.Unlock()
+		sendError(req, badRequest("username", "you can not kick yourself"))
+		return
+	}
+
+	// Выгнанный тоже получает рассылку, так он узнает, что уже не в комнате
+	mem.sendGameBroadcastLocked(game, &ResponseKicked{Message: "kicked", Username: req.Params.Username})
+	kicked := game.Sessions[kickedId]
+	leaveGame(game, kickedId)
+	takePlayerPrompts(game, kickedId)
+	game.Kicked[kickedId] = true
+	if kicked != nil {
+		kicked.GameId = -1
+	}
+	gameId := game.GameId
+	mem.Mutex.Unlock()
+	req.Log.Info("player kicked", "username", req.Params.Username, "game_id", gameId)
+	sendStatus(req, StatusOk)
+}
+
+func (mem *Memory) roomSettingsHandler(req *Request) {
+	session, err := mem.checkToken(req)
+	if err != nil {
+		req.Log.Error("invalid token", "err", err)
+		return
+	}
+	game := mem.hostGame(req, session)
+	if game == nil {
+		return
+	}
+
+	params := req.Params
+	mem.Mutex.Lock()
+	if game.Phase != PhaseLobby {
+		mem.Mutex.Unlock()
+		sendError(req, errGameStarted())
+		return
+	}
+	if params.MaxUsers != nil && *params.MaxUsers < int64(len(game.Sessions)) {
+		mem.Mutex.Unlock()
+		sendError(req, badRequest("maxusers", "there are already %d players in the room", len(game.Sessions)))
+		return
+	}
+	// Командной игре нужно поровну игроков в каждой команде
+	maxUsers, teams := game.MaxUsersCnt, game.TeamsCnt
+	if params.MaxUsers != nil {
+		maxUsers = *params.MaxUsers
+	}
+	if params.Teams != nil {
+		teams = *params.Teams
+	}
+	if teams == 1 {
+		mem.Mutex.Unlock()
+		sendError(req, badRequest("teams", "a team game needs at least 2 teams"))
+		return
+	}
+	if e := checkTeams(teams, maxUsers); e != nil {
+		mem.Mutex.Unlock()
+		sendError(req, badRequest("teams", "%s", e.Message))
+		return
+	}
+	// В bluff у вопроса должен быть верный ответ, поэтому вопросы игроков не принимаются
+	mode, prompts := game.Mode, game.PlayerPromptsCnt
+	if params.Mode != "" {
+		mode = gameModes[params.Mode]
+	}
+	if params.Prompts != nil {
+		prompts = *params.Prompts
+	}
+	if mode == nil {
+		mem.Mutex.Unlock()
+		sendError(req, badRequest("mode", "unknown mode %q", params.Mode))
+		return
+	}
+	if mode.Name() == "bluff" && (prompts > 0 || len(game.Prompts) > 0) {
+		mem.Mutex.Unlock()
+		sendError(req, badRequest("prompts", "bluff mode plays pack prompts only"))
+		return
+	}
+	game.Mode = mode
+	game.MaxUsersCnt = maxUsers
+	if teams != game.TeamsCnt {
+		game.TeamsCnt = teams
+		// Выбранные команды, которых больше нет, забываются
+		for username, team := range game.Teams {
+			if !containsString(teamNames[:teams], team) {
+				delete(game.Teams, username)
+			}
+		}
+	}
+	if params.MaxRounds != nil {
+		game.MaxRoundsCnt = *params.MaxRounds
+	}
+	game.PlayerPromptsCnt = prompts
+	settings := &ResponseRoomSettings{Message: "roomsettings", MaxUsers: game.MaxUsersCnt, MaxRounds: game.MaxRoundsCnt, Prompts: game.PlayerPromptsCnt, Teams: game.TeamsCnt, Mode: game.Mode.Name()}
+	full := int64(len(game.Sessions)) == game.MaxUsersCnt
+	gameId := game.GameId
+	mem.Mutex.Unlock()
+	req.Log.Info("room settings changed", "game_id", gameId, "maxusers", settings.MaxUsers, "maxrounds", settings.MaxRounds, "prompts", settings.Prompts, "teams", settings.Teams, "mode", settings.Mode)
+
+	sendStatus(req, StatusOk)
+	mem.sendGameBroadcast(game, settings)
+	// Хозяин уменьшил комнату до тех, кто уже в ней
+	if full {
+		mem.startLobby(game, session)
+	}
+}
+
+// startGameHandler начинает игру, не дожидаясь, пока комната заполнится
+func (mem *Memory) startGameHandler(req *Request) {
+	session, err := mem.checkToken(req)
+	if err != nil {
+		req.Log.Error("invalid token", "err", err)
+		return
+	}
+	game := mem.hostGame(req, session)
+	if game == nil {
+		return
+	}
+	mem.Mutex.Lock()
+	if game.Phase != PhaseLobby {
+		mem.Mutex.Unlock()
+		sendError(req, errGameStarted())
+		return
+	}
+	playersCnt := len(game.Sessions)
+	teamsCnt := game.TeamsCnt
+	gameId := game.GameId
+	mem.Mutex.Unlock()
+	if playersCnt < minUsersCntConst {
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeNotEnoughPlayers, "at least %d players are needed", minUsersCntConst))
+		return
+	}
+	if e := checkTeams(teamsCnt, int64(playersCnt)); e != nil {
+		sendError(req, e)
+		return
+	}
+
+	if !mem.startLobby(game, session) {
+		sendError(req, errGameStarted())
+		return
+	}
+	sendStatus(req, StatusOk)
+	req.Log.Info("game started by the host", "game_id", gameId, "players", playersCnt)
+}
+
+// nextHost - кто дольше всех в комнате из тех, кто на связи, кроме ботов; пусто, если никого.
+// Вызывается под mem.Mutex.
+func (mem *Memory) nextHost(game *Game) string {
+	for _, userId := range game.Joined {
+		if game.Sessions[userId] != nil && mem.Sessions[userId] != nil && !mem.Users[userId].Bot {
+			return userId
+		}
+	}
+	return ""
+}
+
+// passHost передает роль хозяина дальше, если отключившийся session был хозяином своей комнаты
+func (mem *Memory) passHost(session *Session) {
+	mem.Mutex.Lock()
+	game := mem.Games[session.GameId]
+	if game == nil || game.HostId != session.UserId {
+		mem.Mutex.Unlock()
+		return
+	}
+	game.HostId = mem.nextHost(game)
+	username := ""
+	if game.HostId != "" {
+		username = mem.Users[game.HostId].Username
+		gameLog(game).Info("host changed", "username", username)
+	}
+	mem.Mutex.Unlock()
+	if username == "" {
+		return
+	}
+	mem.sendGameBroadcast(game, &ResponseNewHost{Message: "newhost", Username: username})
+}
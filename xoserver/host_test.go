@@ -0,0 +1,152 @@
+package xoserver
+
+import (
+	"sync"
+	"testing"
+)
+
+// hostLobbyConfig - комната на пятерых, чтобы она не начиналась, когда в нее вошли трое
+func hostLobbyConfig() *Config {
+	config := testConfig()
+	config.MaxUsersCnt = 5
+	return config
+}
+
+func TestHostKick(t *testing.T) {
+	mem, players := newTestLobby(t, hostLobbyConfig(), 3, 3)
+	host := players[0]
+
+	if game := mem.Games[0]; mem.Users[game.HostId].Username != "player0" {
+		t.Fatalf("host %s, want player0", mem.Users[game.HostId].Username)
+	}
+
+	tests := []struct {
+		p        *testPlayer
+		username string
+		code     any
+	}{
+		{players[1], "player2", CodeNotHost},
+		{host, "player0", CodeInvalidRequest},
+		{host, "nobody", CodeNoSuchPlayer},
+		{host, "player1", nil},
+	}
+	for _, tt := range tests {
+		if resp := tt.p.send(mem, RequestParams{Method: "kick", Username: tt.username}); resp["code"] != tt.code {
+			t.Fatalf("kick %s: %v, want %v", tt.username, resp, tt.code)
+		}
+	}
+	game := mem.Games[0]
+	if len(game.Sessions) != 2 || len(game.Joined) != 2 {
+		t.Fatalf("after kick: %d players, joined %v", len(game.Sessions), game.Joined)
+	}
+	if resp := players[1].send(mem, RequestParams{Method: "entergame"}); resp["code"] != CodeKicked {
+		t.Fatalf("entergame after kick: %v", resp)
+	}
+}
+
+func TestHostSettings(t *testing.T) {
+	mem, players := newTestLobby(t, hostLobbyConfig(), 3, 3)
+	game := mem.Games[0]
+
+	if resp := players[1].send(mem, RequestParams{Method: "roomsettings", MaxRounds: int64Param(2)}); resp["code"] != CodeNotHost {
+		t.Fatalf("roomsettings by a player: %v", resp)
+	}
+	if resp := players[0].send(mem, RequestParams{Method: "roomsettings", MaxUsers: int64Param(2)}); resp["field"] != "maxusers" {
+		t.Fatalf("roomsettings with 2 players: %v", resp)
+	}
+	if resp := players[0].send(mem, RequestParams{Method: "roomsettings", MaxRounds: int64Param(2), Prompts: int64Param(1)}); resp["status"] != float64(StatusOk) {
+		t.Fatalf("roomsettings: %v", resp)
+	}
+	if game.MaxRoundsCnt != 2 || game.PlayerPromptsCnt != 1 || game.MaxUsersCnt != 5 {
+		t.Fatalf("settings: %d rounds, %d prompts, %d players", game.MaxRoundsCnt, game.PlayerPromptsCnt, game.MaxUsersCnt)
+	}
+
+	// Комната уменьшена до тех, кто в ней есть, - игра начинается
+	if resp := players[0].send(mem, RequestParams{Method: "roomsettings", MaxUsers: int64Param(3)}); resp["status"] != float64(StatusOk) {
+		t.Fatalf("roomsettings: %v", resp)
+	}
+	waitPhase(t, mem, game, PhaseAnswering)
+	if mem.lastGameId != 1 {
+		t.Errorf("lastGameId %d, want 1", mem.lastGameId)
+	}
+	if resp := players[0].send(mem, RequestParams{Method: "kick", Username: "player1"}); resp["code"] != CodeNotInLobby {
+		t.Fatalf("kick after the start: %v", resp)
+	}
+}
+
+func TestHostStartGame(t *testing.T) {
+	mem, players := newTestLobby(t, hostLobbyConfig(), 3, 2)
+	if resp := players[0].send(mem, RequestParams{Method: "startgame"}); resp["code"] != CodeNotEnoughPlayers {
+		t.Fatalf("startgame with 2 players: %v", resp)
+	}
+	players[2].send(mem, RequestParams{Method: "entergame"})
+	if resp := players[0].send(mem, RequestParams{Method: "startgame"}); resp["status"] != float64(StatusOk) {
+		t.Fatalf("startgame: %v", resp)
+	}
+	mem.Mutex.Lock()
+	game := mem.Games[0]
+	mem.Mutex.Unlock()
+	waitPhase(t, mem, game, PhaseAnswering)
+	mem.Mutex.Lock()
+	defer mem.Mutex.Unlock()
+	if game.MaxUsersCnt != 3 || len(game.Duels) != 3 {
+		t.Fatalf("game of %d players with %d duels, want 3", game.MaxUsersCnt, len(game.Duels))
+	}
+}
+
+// Комнату начинают сразу несколько: хозяин, его настройки и последний вошедший
+func TestStartLobbyOnce(t *testing.T) {
+	mem, _ := newTestLobby(t, hostLobbyConfig(), 3, 3)
+	mem.Mutex.Lock()
+	game := mem.Games[0]
+	host := game.Sessions[game.HostId]
+	mem.Mutex.Unlock()
+
+	started := make(chan bool, 10)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < cap(started); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			started <- mem.startLobby(game, host)
+		}()
+	}
+	wg.Wait()
+	close(started)
+	cnt := 0
+	for ok := range started {
+		if ok {
+			cnt += 1
+		}
+	}
+	mem.Mutex.Lock()
+	lastGameId := mem.lastGameId
+	mem.Mutex.Unlock()
+	if cnt != 1 || lastGameId != 1 {
+		t.Fatalf("lobby started %d times, lastGameId %d", cnt, lastGameId)
+	}
+	waitPhase(t, mem, game, PhaseAnswering)
+}
+
+func TestHostMigration(t *testing.T) {
+	mem, _ := newTestLobby(t, hostLobbyConfig(), 3, 3)
+	game := mem.Games[0]
+	first := game.Joined[0]
+
+	// Хозяин отключился: как в конце newClient
+	session := mem.Sessions[first]
+	delete(mem.Sessions, first)
+	mem.passHost(session)
+	if game.HostId != game.Joined[1] {
+		t.Fatalf("host %s, want %s", game.HostId, game.Joined[1])
+	}
+
+	// Отключился не хозяин - хозяин тот же
+	other := game.Joined[2]
+	session = mem.Sessions[other]
+	delete(mem.Sessions, other)
+	mem.passHost(session)
+	if game.HostId != game.Joined[1] {
+		t.Fatalf("host %s after another player left, want %s", game.HostId, game.Joined[1])
+	}
+}
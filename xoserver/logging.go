@@ -0,0 +1,50 @@
+package xoserver
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"Xo-xo-touch/xocodec"
+)
+
+// Request - один запрос клиента вместе с логгером, в котором уже есть все, что о нем известно
+type Request struct {
+	ConnId     int64
+	Method     string
+	ConnReq    net.Conn
+	ConnBrcast net.Conn
+	Params     *RequestParams
+	Client     *ClientInfo
+	Codec      xocodec.Codec // кодировка ответа, какой она была, когда пришел запрос
+	Start      time.Time
+	Log        *slog.Logger
+}
+
+var logLevel = &slog.LevelVar{}
+
+func parseLogLevel(level string) (slog.Level, error) {
+	l := slog.LevelInfo
+	err := l.UnmarshalText([]byte(level))
+	return l, err
+}
+
+// NewLogger создает логгер сервера. Уровень можно менять на лету через logLevel.
+func NewLogger(w io.Writer, format string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: logLevel}
+	if strings.ToLower(format) == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// withSession добавляет в логгер запроса пользователя и игру. Вызывается под mem.Mutex.
+func (req *Request) withSession(session *Session) {
+	req.Log = req.Log.With("user_id", session.UserId, "game_id", session.GameId)
+}
+
+func gameLog(game *Game) *slog.Logger {
+	return slog.With("game_id", game.GameId)
+}
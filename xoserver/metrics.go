@@ -0,0 +1,221 @@
+package xoserver
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Метрики отдаются в текстовом формате Prometheus на /metrics
+
+type MetricType string
+
+const (
+	MetricCounter   MetricType = "counter"
+	MetricGauge     MetricType = "gauge"
+	MetricHistogram MetricType = "histogram"
+)
+
+var defaultLatencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+type metricValue struct {
+	LabelValues []string
+	Value       float64
+	Buckets     []uint64 // только для гистограмм
+	Sum         float64
+	Count       uint64
+}
+
+type Metric struct {
+	Mutex  *sync.Mutex
+	Name   string
+	Help   string
+	Type   MetricType
+	Labels []string
+	Bounds []float64               // границы корзин гистограммы
+	Values map[string]*metricValue // значения меток через \xff -> значение
+}
+
+func newMetric(name string, help string, metricType MetricType, labels ...string) *Metric {
+	return &Metric{
+		Mutex:  &sync.Mutex{},
+		Name:   name,
+		Help:   help,
+		Type:   metricType,
+		Labels: labels,
+		Values: map[string]*metricValue{},
+	}
+}
+
+func (m *Metric) value(labelValues []string) *metricValue {
+	key := strings.Join(labelValues, "\xff")
+	v, ok := m.Values[key]
+	if !ok {
+		v = &metricValue{LabelValues: labelValues}
+		if m.Type == MetricHistogram {
+			v.Buckets = make([]uint64, len(m.Bounds))
+		}
+		m.Values[key] = v
+	}
+	return v
+}
+
+func (m *Metric) Add(delta float64, labelValues ...string) {
+	m.Mutex.Lock()
+	m.value(labelValues).Value += delta
+	m.Mutex.Unlock()
+}
+
+func (m *Metric) Inc(labelValues ...string) {
+	m.Add(1, labelValues...)
+}
+
+func (m *Metric) Dec(labelValues ...string) {
+	m.Add(-1, labelValues...)
+}
+
+func (m *Metric) Observe(x float64, labelValues ...string) {
+	m.Mutex.Lock()
+	v := m.value(labelValues)
+	for i, bound := range m.Bounds {
+		if x <= bound {
+			v.Buckets[i] += 1
+		}
+	}
+	v.Sum += x
+	v.Count += 1
+	m.Mutex.Unlock()
+}
+
+func formatLabels(names []string, values []string, extra ...string) string {
+	pairs := []string{}
+	for i, name := range names {
+		pairs = append(pairs, name+"=\""+escapeLabel(values[i])+"\"")
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+"=\""+escapeLabel(extra[i+1])+"\"")
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeLabel(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
+
+func formatFloat(x float64) string {
+	return strconv.FormatFloat(x, 'g', -1, 64)
+}
+
+func (m *Metric) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.Name, m.Help, m.Name, m.Type)
+
+	values := []*metricValue{}
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	for _, v := range m.Values {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return strings.Join(values[i].LabelValues, "\xff") < strings.Join(values[j].LabelValues, "\xff")
+	})
+
+	for _, v := range values {
+		if m.Type != MetricHistogram {
+			fmt.Fprintf(w, "%s%s %s\n", m.Name, formatLabels(m.Labels, v.LabelValues), formatFloat(v.Value))
+			continue
+		}
+		for i, bound := range m.Bounds {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.Name, formatLabels(m.Labels, v.LabelValues, "le", formatFloat(bound)), v.Buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", m.Name, formatLabels(m.Labels, v.LabelValues, "le", "+Inf"), v.Count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", m.Name, formatLabels(m.Labels, v.LabelValues), formatFloat(v.Sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", m.Name, formatLabels(m.Labels, v.LabelValues), v.Count)
+	}
+}
+
+type Metrics struct {
+	OpenConnections   *Metric
+	ActiveSessions    *Metric
+	RoomsByPhase      *Metric
+	GamesStarted      *Metric
+	GamesFinished     *Metric
+	Requests          *Metric
+	RequestLatency    *Metric
+	BroadcastFailures *Metric
+	PhaseDuration     *Metric
+	ModerationFlags   *Metric
+}
+
+func newMetrics() *Metrics {
+	m := &Metrics{
+		OpenConnections:   newMetric("xoxo_open_connections", "Client connections that are open now.", MetricGauge),
+		ActiveSessions:    newMetric("xoxo_active_sessions", "Logged in sessions with an open broadcast queue.", MetricGauge),
+		RoomsByPhase:      newMetric("xoxo_rooms", "Rooms by the phase of their game.", MetricGauge, "phase"),
+		GamesStarted:      newMetric("xoxo_games_started_total", "Games that have started.", MetricCounter),
+		GamesFinished:     newMetric("xoxo_games_finished_total", "Games that have ended.", MetricCounter),
+		Requests:          newMetric("xoxo_requests_total", "Requests handled, by method.", MetricCounter, "method"),
+		RequestLatency:    newMetric("xoxo_request_duration_seconds", "Time to handle a request, by method.", MetricHistogram, "method"),
+		BroadcastFailures: newMetric("xoxo_broadcast_failures_total", "Broadcasts that did not reach a client, by reason.", MetricCounter, "reason"),
+		PhaseDuration:     newMetric("xoxo_phase_duration_seconds", "Time rooms spent in a phase; sum / count is the average.", MetricHistogram, "phase"),
+		ModerationFlags:   newMetric("xoxo_moderation_flags_total", "Texts flagged for review, by kind; see /moderation/flags.", MetricCounter, "kind"),
+	}
+	m.RequestLatency.Bounds = defaultLatencyBuckets
+	m.PhaseDuration.Bounds = []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800}
+	// Метрики без меток видны сразу, даже если еще ничего не произошло
+	for _, metric := range m.all() {
+		if len(metric.Labels) == 0 {
+			metric.Add(0)
+		}
+	}
+	return m
+}
+
+func (m *Metrics) all() []*Metric {
+	return []*Metric{
+		m.OpenConnections,
+		m.ActiveSessions,
+		m.RoomsByPhase,
+		m.GamesStarted,
+		m.GamesFinished,
+		m.Requests,
+		m.RequestLatency,
+		m.BroadcastFailures,
+		m.PhaseDuration,
+		m.ModerationFlags,
+	}
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, metric := range m.all() {
+		metric.write(w)
+	}
+}
+
+var metrics = newMetrics()
+
+// methodLabel не дает неизвестным методам раздувать число меток
+func methodLabel(method string) string {
+	for _, m := range requestMethods {
+		if m == method {
+			return method
+		}
+	}
+	return "unknown"
+}
+
+func observeRequest(req *Request) {
+	method := methodLabel(req.Method)
+	metrics.Requests.Inc(method)
+	metrics.RequestLatency.Observe(time.Since(req.Start).Seconds(), method)
+}
@@ -0,0 +1,48 @@
+package xoserver
+
+// Режимы игры. Движок дуэлей у всех один: игроки по кругу делятся на пары, каждый отвечает
+// на вопросы своих двух дуэлей, потом за дуэли голосуют по одной. Режим решает, о чем дуэль,
+// какие ответы принимаются, из чего выбирают голосующие и кому за голос идут очки.
+
+// GameMode - правила одного режима. Методы без состояния: все, что нужно, лежит в Game и Duel.
+type GameMode interface {
+	Name() string
+	// FillQuestion дает дуэли вопрос из пакета режима: start - с какого номера искать,
+	// round - вопросы, которые уже есть в этом раунде. Вызывается под mem.Mutex.
+	FillQuestion(game *Game, duel *Duel, start int64, round map[string]bool)
+	// CheckAnswer - nil, если ответ на вопрос дуэли можно принять
+	CheckAnswer(duel *Duel, answer string) *ResponseError
+	// PrepareVoting готовит дуэль к голосованию, когда все ответили
+	PrepareVoting(duel *Duel)
+	// Options - варианты, из которых выбирают голосующие (getduel), номер варианта - голос
+	Options(duel *Duel) []string
+	// Vote записывает голос voter за вариант vote и начисляет очки
+	Vote(game *Game, duel *Duel, voter string, vote int64)
+}
+
+var gameModes = map[string]GameMode{
+	classicMode{}.Name(): classicMode{},
+	bluffMode{}.Name():   bluffMode{},
+}
+
+const gameModeConst = "classic"
+
+// classicMode - обычная игра: двое отвечают на вопрос, остальные голосуют за ответ посмешнее
+type classicMode struct{}
+
+func (classicMode) Name() string { return "classic" }
+
+func (classicMode) FillQuestion(game *Game, duel *Duel, start int64, round map[string]bool) {
+	duel.Question = packQuestion(game, questions, start, round)
+}
+
+func (classicMode) CheckAnswer(duel *Duel, answer string) *ResponseError { return nil }
+
+func (classicMode) PrepareVoting(duel *Duel) {}
+
+func (classicMode) Options(duel *Duel) []string { return duel.Answers }
+
+func (classicMode) Vote(game *Game, duel *Duel, voter string, vote int64) {
+	duel.Votes[vote] = append(duel.Votes[vote], voter)
+	addPoints(game, duel.Usernames[vote], 10*(game.RoundNum+1))
+}
@@ -0,0 +1,396 @@
+package xoserver
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+type ContentKind string
+
+const (
+	ContentUsername ContentKind = "username"
+	ContentAnswer   ContentKind = "answer"
+	ContentChat     ContentKind = "chat"
+	ContentPrompt   ContentKind = "prompt"
+)
+
+type ModerationAction string
+
+const (
+	ActionBlock ModerationAction = "block" // отклонить текст целиком
+	ActionMask  ModerationAction = "mask"  // заменить запрещенные слова маской
+	ActionFlag  ModerationAction = "flag"  // пропустить, но сохранить на проверку
+)
+
+const maxModerationFlagsConst = 200 // столько последних отмеченных текстов видно на /moderation/flags
+
+type ModerationRule struct {
+	MinLen int64            `json:"minlen"`
+	MaxLen int64            `json:"maxlen"`
+	Action ModerationAction `json:"action"`
+}
+
+type ModerationFlag struct {
+	Time     time.Time   `json:"time"`
+	Kind     ContentKind `json:"kind"`
+	Username string      `json:"username"`
+	Text     string      `json:"text"`
+	Words    []string    `json:"words"`
+}
+
+type Moderator struct {
+	Mutex *sync.Mutex
+	Words []*bannedWord
+	Mask  rune
+	Rules map[ContentKind]ModerationRule
+	Flags []*ModerationFlag // последние maxModerationFlagsConst, старые вытесняются
+}
+
+// letterRun - одна буква, повторенная Count раз подряд
+type letterRun struct {
+	Letter rune
+	Count  int
+}
+
+type bannedWord struct {
+	Word string      // в каноническом виде, как в отчетах
+	Runs []letterRun // повторы букв из списка сохраняются: "ass" - это a и две s
+}
+
+// textToken - слово текста и его первая и последняя руны в исходном тексте
+type textToken struct {
+	Runs  []letterRun
+	Start int
+	End   int
+}
+
+var defaultBannedWords = []string{
+	"дурак",
+	"идиот",
+	"fuck",
+	"shit",
+}
+
+var defaultModerationRules = map[ContentKind]ModerationRule{
+	ContentUsername: {MinLen: 2, MaxLen: 20, Action: ActionBlock},
+	ContentAnswer:   {MinLen: 1, MaxLen: 100, Action: ActionMask},
+	ContentChat:     {MinLen: 1, MaxLen: 200, Action: ActionMask},
+	ContentPrompt:   {MinLen: 5, MaxLen: 150, Action: ActionFlag},
+}
+
+// confusables сводит похожие друг на друга символы к одному виду,
+// чтобы "дурaк" с латинской "a" или "fu©k" не проходили мимо списка
+var confusables = map[rune]rune{
+	// Кириллица, похожая на латиницу
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'з': '3', 'к': 'k', 'м': 'm', 'н': 'h',
+	'о': 'o', 'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'ԁ': 'd', 'і': 'i',
+	'ј': 'j', 'ѕ': 's', 'һ': 'h', 'ԛ': 'q', 'ԝ': 'w',
+	// Греческие буквы
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o',
+	'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'ω': 'w',
+	// Цифры и знаки вместо букв
+	'0': 'o', '1': 'i', 'l': 'i', '|': 'i', '!': 'i', '4': 'a', '@': 'a', '5': 's',
+	'$': 's', '7': 't', '©': 'c', '®': 'p',
+	// Латиница с диакритикой
+	'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'å': 'a', 'ç': 'c', 'è': 'e',
+	'é': 'e', 'ê': 'e', 'ë': 'e', 'ì': 'i', 'í': 'i', 'î': 'i', 'ï': 'i', 'ñ': 'n',
+	'ò': 'o', 'ó': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o', 'ø': 'o', 'ù': 'u', 'ú': 'u',
+	'û': 'u', 'ü': 'u', 'ý': 'y', 'ÿ': 'y', 'ś': 's', 'š': 's', 'ž': 'z', 'ł': 'i',
+}
+
+func newModerator(words []string, rules map[ContentKind]ModerationRule) *Moderator {
+	m := &Moderator{
+		Mutex: &sync.Mutex{},
+		Mask:  '*',
+		Flags: []*ModerationFlag{},
+	}
+	m.Update(words, rules)
+	return m
+}
+
+// Update заменяет список слов и правила (например, после перечитывания настроек)
+func (m *Moderator) Update(words []string, rules map[ContentKind]ModerationRule) {
+	newRules := map[ContentKind]ModerationRule{}
+	for kind, rule := range defaultModerationRules {
+		newRules[kind] = rule
+	}
+	for kind, rule := range rules {
+		newRules[kind] = rule
+	}
+	newWords := []*bannedWord{}
+	for _, w := range words {
+		normalized := []rune{}
+		for _, r := range w {
+			if n := normalizeRune(r); n != 0 {
+				normalized = append(normalized, n)
+			}
+		}
+		if len(normalized) > 0 {
+			newWords = append(newWords, &bannedWord{Word: string(normalized), Runs: appendRuns(nil, normalized)})
+		}
+	}
+	m.Mutex.Lock()
+	m.Rules = newRules
+	m.Words = newWords
+	m.Mutex.Unlock()
+}
+
+// loadWordList читает по одному слову из строки, строки с # пропускаются
+func loadWordList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	words := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	return words, scanner.Err()
+}
+
+// normalizeRune возвращает канонический вид символа или 0, если символ не учитывается при сравнении
+func normalizeRune(r rune) rune {
+	// Полноширинные формы ASCII
+	if r >= 0xFF01 && r <= 0xFF5E {
+		r -= 0xFEE0
+	}
+	r = unicode.ToLower(r)
+	if c, ok := confusables[r]; ok {
+		r = c
+	}
+	if unicode.IsLetter(r) || unicode.IsDigit(r) {
+		return r
+	}
+	return 0
+}
+
+// appendRuns добавляет буквы к runs, сводя повторы одной буквы в один letterRun
+func appendRuns(runs []letterRun, letters []rune) []letterRun {
+	for _, r := range letters {
+		if len(runs) > 0 && runs[len(runs)-1].Letter == r {
+			runs[len(runs)-1].Count += 1
+			continue
+		}
+		runs = append(runs, letterRun{Letter: r, Count: 1})
+	}
+	return runs
+}
+
+// tokenizeText делит текст на слова: подряд идущие символы, которые normalizeRune считает буквами.
+// Знаки вроде "!" и "$" на краях слова могут быть и буквами ("a$$"), и пунктуацией ("fuck!"),
+// поэтому такое слово проверяется в обоих видах.
+// Несколько однобуквенных слов подряд ("f u c k") дают еще и слово из этих букв.
+func tokenizeText(text string) []*textToken {
+	runes := []rune(text)
+	tokens := []*textToken{}
+	for i := 0; i < len(runes); {
+		if normalizeRune(runes[i]) == 0 {
+			i++
+			continue
+		}
+		start := i
+		for i < len(runes) && normalizeRune(runes[i]) != 0 {
+			i++
+		}
+		end := i - 1
+		tokens = append(tokens, newTextToken(runes, start, end))
+		// Без знаков на краях - еще одно слово
+		trimmedStart, trimmedEnd := start, end
+		for trimmedStart <= trimmedEnd && !isLetterOrDigit(runes[trimmedStart]) {
+			trimmedStart++
+		}
+		for trimmedEnd >= trimmedStart && !isLetterOrDigit(runes[trimmedEnd]) {
+			trimmedEnd--
+		}
+		if trimmedStart <= trimmedEnd && (trimmedStart != start || trimmedEnd != end) {
+			tokens = append(tokens, newTextToken(runes, trimmedStart, trimmedEnd))
+		}
+	}
+
+	// Слово из однобуквенных попадает в tokens со второй буквы, дальше буквы дописываются в него же
+	var single *textToken
+	singles := 0
+	for _, t := range tokens {
+		if t.Start != t.End {
+			single, singles = nil, 0
+			continue
+		}
+		if single == nil {
+			single = &textToken{Start: t.Start}
+		}
+		single.Runs = appendRuns(single.Runs, []rune{t.Runs[0].Letter})
+		single.End = t.End
+		singles += 1
+		if singles == 2 {
+			tokens = append(tokens, single)
+		}
+	}
+	return tokens
+}
+
+func newTextToken(runes []rune, start int, end int) *textToken {
+	letters := []rune{}
+	for _, r := range runes[start : end+1] {
+		letters = append(letters, normalizeRune(r))
+	}
+	return &textToken{Runs: appendRuns(nil, letters), Start: start, End: end}
+}
+
+func isLetterOrDigit(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// matchWord - слово текста совпадает с запрещенным с точностью до лишних повторов букв: "дуураак" - это "дурак"
+func matchWord(token *textToken, word *bannedWord) bool {
+	if len(token.Runs) != len(word.Runs) {
+		return false
+	}
+	for i, run := range token.Runs {
+		if run.Letter != word.Runs[i].Letter || run.Count < word.Runs[i].Count {
+			return false
+		}
+	}
+	return true
+}
+
+// sanitizeText убирает управляющие и невидимые символы, переводы строк и лишние пробелы
+func sanitizeText(text string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) || unicode.Is(unicode.Co, r) || r == unicode.ReplacementChar {
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteRune(' ')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Check проверяет текст и возвращает его очищенную версию или ошибку для клиента
+func (m *Moderator) Check(kind ContentKind, username string, text string) (string, *ResponseError) {
+	m.Mutex.Lock()
+	rule, ok := m.Rules[kind]
+	words := m.Words
+	mask := m.Mask
+	m.Mutex.Unlock()
+	if !ok {
+		rule = ModerationRule{MaxLen: 1000, Action: ActionBlock}
+	}
+
+	// Огромный текст не разбираем вовсе
+	if rule.MaxLen > 0 && int64(len(text)) > rule.MaxLen*8 {
+		return "", newError(ErrTooLarge, CodeTextTooLong, "%s is longer than %d characters", kind, rule.MaxLen)
+	}
+	text = sanitizeText(text)
+	length := int64(len([]rune(text)))
+	if length < rule.MinLen || length == 0 {
+		return "", newError(ErrNotAcceptable, CodeTextTooShort, "%s is shorter than %d characters", kind, max(rule.MinLen, 1))
+	}
+	if rule.MaxLen > 0 && length > rule.MaxLen {
+		return "", newError(ErrTooLarge, CodeTextTooLong, "%s is longer than %d characters", kind, rule.MaxLen)
+	}
+
+	// Сравниваются слова целиком, иначе "ass" нашлось бы в "class", а "shit" - в "this hit"
+	runes := []rune(text)
+	tokens := tokenizeText(text)
+	found := []string{}
+	masked := make([]bool, len(runes))
+	for _, word := range words {
+		matched := false
+		for _, token := range tokens {
+			if !matchWord(token, word) {
+				continue
+			}
+			matched = true
+			for j := token.Start; j <= token.End; j++ {
+				masked[j] = true
+			}
+		}
+		if matched {
+			found = append(found, word.Word)
+		}
+	}
+	if len(found) == 0 {
+		return text, nil
+	}
+
+	switch rule.Action {
+	case ActionMask:
+		for i := range runes {
+			if masked[i] && !unicode.IsSpace(runes[i]) {
+				runes[i] = mask
+			}
+		}
+		return string(runes), nil
+	case ActionFlag:
+		m.addFlag(&ModerationFlag{
+			Time:     time.Now(),
+			Kind:     kind,
+			Username: username,
+			Text:     text,
+			Words:    found,
+		})
+		slog.Warn("content flagged for review", "kind", kind, "username", username, "text", text, "words", found)
+		return text, nil
+	default:
+		return "", newError(ErrNotAcceptable, CodeTextRejected, "%s contains words that are not allowed", kind)
+	}
+}
+
+func (m *Moderator) addFlag(flag *ModerationFlag) {
+	m.Mutex.Lock()
+	m.Flags = append(m.Flags, flag)
+	if len(m.Flags) > maxModerationFlagsConst {
+		m.Flags = append([]*ModerationFlag{}, m.Flags[len(m.Flags)-maxModerationFlagsConst:]...)
+	}
+	m.Mutex.Unlock()
+	metrics.ModerationFlags.Inc(string(flag.Kind))
+}
+
+// RecentFlags - последние отмеченные тексты, от старых к новым
+func (m *Moderator) RecentFlags() []*ModerationFlag {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	return append([]*ModerationFlag{}, m.Flags...)
+}
+
+// moderationFlagsHandler отдает оператору последние отмеченные на проверку тексты. В них имена
+// и сообщения игроков, а порт http открыт для метрик, поэтому нужен Config.AdminToken.
+func (mem *Memory) moderationFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	token := mem.config().AdminToken
+	if token == "" {
+		http.NotFound(w, r)
+		return
+	}
+	auth := r.Header.Get("Authorization")
+	if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mem.Moderator.RecentFlags())
+}
@@ -0,0 +1,110 @@
+package xoserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestModeratorMask(t *testing.T) {
+	m := newModerator(append([]string{"ass"}, defaultBannedWords...), nil)
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		// Запрещенные слова
+		{"ты дурак", "ты *****"},
+		{"ты ДУУРААК!", "ты *******!"},
+		{"ты дурaк", "ты *****"}, // латинская a
+		{"what the fu©k", "what the ****"},
+		{"sh!t happens", "**** happens"},
+		{"f u c k this", "* * * * this"},
+		{"kick his ass.", "kick his ***."},
+		{"a$$", "***"},
+		{"asss", "****"},
+		// Не слова из списка, хотя буквы подряд те же
+		{"this hit me", "this hit me"},
+		{"was in Vegas", "was in Vegas"},
+		{"first class", "first class"},
+		{"Sasha", "Sasha"},
+		{"as", "as"},
+		{"дура каша", "дура каша"},
+		{"дураки", "дураки"},
+	}
+	for _, tt := range tests {
+		got, err := m.Check(ContentChat, "player", tt.text)
+		if err != nil || got != tt.want {
+			t.Errorf("%q: got %q, %v, want %q", tt.text, got, err, tt.want)
+		}
+	}
+}
+
+func TestModeratorBlock(t *testing.T) {
+	m := newModerator([]string{"ass", "идиот"}, nil)
+
+	tests := []struct {
+		username string
+		code     any
+	}{
+		{"Sasha", nil},
+		{"Vegas", nil},
+		{"classic", nil},
+		{"ass", CodeTextRejected},
+		{"big-ass", CodeTextRejected},
+		{"ИДИОТ", CodeTextRejected},
+		{"идиотство", nil},
+	}
+	for _, tt := range tests {
+		_, err := m.Check(ContentUsername, tt.username, tt.username)
+		var code any
+		if err != nil {
+			code = err.Code
+		}
+		if code != tt.code {
+			t.Errorf("%q: %v, want %v", tt.username, err, tt.code)
+		}
+	}
+}
+
+func TestModeratorFlags(t *testing.T) {
+	config := testConfig()
+	config.AdminToken = "admin-token"
+	mem := newTestMemory(t, config)
+	mem.Moderator = newModerator([]string{"идиот"}, nil)
+	for i := 0; i < maxModerationFlagsConst+5; i++ {
+		if _, err := mem.Moderator.Check(ContentPrompt, "player", "кто тут идиот?"); err != nil {
+			t.Fatalf("flagged prompt rejected: %v", err)
+		}
+	}
+
+	// Без токена в настройках список не отдается никому
+	w := httptest.NewRecorder()
+	newTestMemory(t, testConfig()).moderationFlagsHandler(w, httptest.NewRequest("GET", "/moderation/flags", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("/moderation/flags without admintoken: status %d", w.Code)
+	}
+	// Имена и тексты игроков видны только с токеном
+	for _, auth := range []string{"", "Bearer wrong-token"} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/moderation/flags", nil)
+		r.Header.Set("Authorization", auth)
+		mem.moderationFlagsHandler(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("/moderation/flags with %q: status %d", auth, w.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/moderation/flags", nil)
+	r.Header.Set("Authorization", "Bearer admin-token")
+	mem.moderationFlagsHandler(w, r)
+	flags := []*ModerationFlag{}
+	if err := json.Unmarshal(w.Body.Bytes(), &flags); err != nil {
+		t.Fatalf("/moderation/flags: %v: %s", err, w.Body)
+	}
+	if len(flags) != maxModerationFlagsConst || flags[0].Kind != ContentPrompt || len(flags[0].Words) != 1 {
+		t.Fatalf("%d flags, first %+v", len(flags), flags[0])
+	}
+}
@@ -0,0 +1,210 @@
+package xoserver
+
+import (
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+type SlowConsumerPolicy string
+
+const (
+	PolicyDrop       SlowConsumerPolicy = "drop"       // новое сообщение выбрасывается
+	PolicyLatest     SlowConsumerPolicy = "latest"     // снимок состояния заменяет свой прежний снимок в очереди, иначе как disconnect
+	PolicyDisconnect SlowConsumerPolicy = "disconnect" // соединение закрывается
+)
+
+const (
+	outboxQueueLenConst     = 64
+	writeTimeoutConst       = 5 // seconds
+	slowConsumerPolicyConst = PolicyDisconnect
+)
+
+// outboxItem - сообщение в очереди. Snapshot не пуст у сообщений, которые целиком несут
+// какое-то состояние (состав команд, настройки комнаты): свежий снимок делает прежний ненужным.
+// События (чат, смена фазы, новый игрок) снимками не являются, и терять их нельзя.
+type outboxItem struct {
+	Data     []byte
+	Snapshot string
+}
+
+// snapshotKind - вид снимка состояния для сообщения v, "" - если это событие
+func snapshotKind(v interface{}) string {
+	switch v.(type) {
+	case *ResponseTeams:
+		return "teams"
+	case *ResponseRoomSettings:
+		return "roomsettings"
+	}
+	return ""
+}
+
+// Outbox - очередь исходящих броадкастов одной сессии. Пишет в соединение своя горутина,
+// поэтому медленный клиент не задерживает ни комнату, ни обработчик запроса.
+type Outbox struct {
+	Mutex        *sync.Mutex
+	Conn         net.Conn
+	Queue        []outboxItem
+	QueueLen     int64
+	Policy       SlowConsumerPolicy
+	WriteTimeout time.Duration
+	Notify       chan struct{}
+	Closed       bool
+	Log          *slog.Logger
+}
+
+func newOutbox(conn net.Conn, config OutboxConfig, log *slog.Logger) *Outbox {
+	o := &Outbox{
+		Log:          log,
+		Mutex:        &sync.Mutex{},
+		Conn:         conn,
+		Queue:        []outboxItem{},
+		QueueLen:     config.QueueLen,
+		Policy:       config.Policy,
+		WriteTimeout: seconds(config.WriteTimeout),
+		Notify:       make(chan struct{}, 1),
+	}
+	metrics.ActiveSessions.Inc()
+	go o.run(o.Notify)
+	return o
+}
+
+// Send ставит сообщение-событие в очередь и сразу возвращается
+func (o *Outbox) Send(data []byte) bool {
+	return o.send(outboxItem{Data: data})
+}
+
+// SendSnapshot ставит в очередь снимок состояния вида kind
+func (o *Outbox) SendSnapshot(kind string, data []byte) bool {
+	return o.send(outboxItem{Data: data, Snapshot: kind})
+}
+
+func (o *Outbox) send(item outboxItem) bool {
+	o.Mutex.Lock()
+	if o.Closed || o.Conn == nil {
+		o.Mutex.Unlock()
+		return false
+	}
+	if int64(len(o.Queue)) >= o.QueueLen {
+		switch {
+		case o.Policy == PolicyLatest && item.Snapshot != "" && o.dropSnapshot(item.Snapshot):
+			// Прежний снимок больше не нужен, новый встанет вместо него
+			metrics.BroadcastFailures.Inc("merged")
+		case o.Policy == PolicyDrop:
+			o.Mutex.Unlock()
+			o.Log.Warn("outbox is full, message dropped")
+			metrics.BroadcastFailures.Inc("dropped")
+			return false
+		default:
+			conn := o.Conn
+			o.Mutex.Unlock()
+			o.Log.Warn("outbox is full, closing slow connection")
+			metrics.BroadcastFailures.Inc("disconnected")
+			o.Close()
+			conn.Close()
+			return false
+		}
+	}
+	o.Queue = append(o.Queue, item)
+	select {
+	case o.Notify <- struct{}{}:
+	default:
+	}
+	o.Mutex.Unlock()
+	return true
+}
+
+// dropSnapshot убирает из очереди прежний снимок вида kind. Новый встанет в конец,
+// чтобы не обогнать события, отправленные раньше него. Вызывается под o.Mutex.
+func (o *Outbox) dropSnapshot(kind string) bool {
+	for i, item := range o.Queue {
+		if item.Snapshot == kind {
+			o.Queue = append(o.Queue[:i], o.Queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// SetConn переключает очередь на новое соединение (если клиент переподключился)
+func (o *Outbox) SetConn(conn net.Conn) {
+	o.Mutex.Lock()
+	defer o.Mutex.Unlock()
+	if o.Conn == conn {
+		return
+	}
+	o.Conn = conn
+	if o.Closed {
+		o.Closed = false
+		o.Queue = o.Queue[:0]
+		o.Notify = make(chan struct{}, 1)
+		metrics.ActiveSessions.Inc()
+		go o.run(o.Notify)
+	}
+}
+
+func (o *Outbox) Close() {
+	o.Mutex.Lock()
+	o.close()
+	o.Mutex.Unlock()
+}
+
+// close - то же, что Close. Вызывается под o.Mutex.
+func (o *Outbox) close() {
+	if !o.Closed {
+		o.Closed = true
+		close(o.Notify)
+		metrics.ActiveSessions.Dec()
+	}
+}
+
+// run пишет очередь в соединение, пока не закрыт notify. После переподключения SetConn запускает
+// новую run со своим notify, а прежняя, даже если еще дописывает в старое соединение, очередь не трогает.
+func (o *Outbox) run(notify chan struct{}) {
+	for range notify {
+		for {
+			o.Mutex.Lock()
+			if len(o.Queue) == 0 || o.Closed || o.Notify != notify {
+				o.Mutex.Unlock()
+				break
+			}
+			data := o.Queue[0].Data
+			o.Queue = o.Queue[1:]
+			conn := o.Conn
+			timeout := o.WriteTimeout
+			o.Mutex.Unlock()
+
+			err := conn.SetWriteDeadline(time.Now().Add(timeout))
+			if err == nil {
+				_, err = conn.Write(data)
+			}
+			if err != nil {
+				// После неудачной записи поток сообщений уже не восстановить
+				o.Log.Error("write broadcast", "err", err)
+				metrics.BroadcastFailures.Inc("write_error")
+				o.Mutex.Lock()
+				if o.Notify == notify {
+					o.close()
+				}
+				o.Mutex.Unlock()
+				conn.Close()
+				break
+			}
+		}
+	}
+}
+
+// Drain ждет, пока очередь опустеет, но не дольше timeout
+func (o *Outbox) Drain(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		o.Mutex.Lock()
+		empty := len(o.Queue) == 0 || o.Closed
+		o.Mutex.Unlock()
+		if empty {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
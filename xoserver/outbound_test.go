@@ -0,0 +1,81 @@
+package xoserver
+
+import (
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+)
+
+// newStuckOutbox - очередь на два сообщения к клиенту, который ничего не читает
+func newStuckOutbox(t *testing.T, policy SlowConsumerPolicy) *Outbox {
+	t.Helper()
+	conn, peer := net.Pipe()
+	t.Cleanup(func() { conn.Close(); peer.Close() })
+	o := newOutbox(conn, OutboxConfig{QueueLen: 2, WriteTimeout: 60, Policy: policy}, slog.Default())
+	// Первое сообщение горутина забирает из очереди и застревает на записи
+	o.Send([]byte("first"))
+	o.Drain(time.Second)
+	return o
+}
+
+func (o *Outbox) closed() bool {
+	o.Mutex.Lock()
+	defer o.Mutex.Unlock()
+	return o.Closed
+}
+
+func TestOutboxLatest(t *testing.T) {
+	o := newStuckOutbox(t, PolicyLatest)
+	o.SendSnapshot("teams", []byte("teams 1"))
+	o.Send([]byte("chat"))
+	if !o.SendSnapshot("teams", []byte("teams 2")) {
+		t.Fatalf("snapshot was not merged")
+	}
+	o.Mutex.Lock()
+	queue := []string{}
+	for _, item := range o.Queue {
+		queue = append(queue, string(item.Data))
+	}
+	o.Mutex.Unlock()
+	if len(queue) != 2 || queue[0] != "chat" || queue[1] != "teams 2" {
+		t.Fatalf("queue %q, want chat, teams 2", queue)
+	}
+	// Событие в полную очередь не влезает, и клиента отключают
+	if o.Send([]byte("gamestarted")) || !o.closed() {
+		t.Fatalf("event into a full queue: closed %v", o.closed())
+	}
+}
+
+// Ошибка записи в прежнее соединение не закрывает очередь, которую уже переключили на новое
+func TestOutboxReconnect(t *testing.T) {
+	o := newStuckOutbox(t, slowConsumerPolicyConst)
+	old := o.Conn
+	o.Close()
+	conn, peer := net.Pipe()
+	t.Cleanup(func() { conn.Close(); peer.Close() })
+	o.SetConn(conn)
+
+	// Прежняя горутина все еще пишет "first" в старое соединение
+	old.Close()
+	time.Sleep(20 * time.Millisecond)
+	if o.closed() {
+		t.Fatal("stale write error closed the outbox")
+	}
+	o.Send([]byte("rematch"))
+	peer.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 16)
+	n, err := peer.Read(buf)
+	if err != nil || string(buf[:n]) != "rematch" {
+		t.Fatalf("read %q, %v", buf[:n], err)
+	}
+}
+
+func TestOutboxDisconnect(t *testing.T) {
+	o := newStuckOutbox(t, slowConsumerPolicyConst)
+	o.SendSnapshot("teams", []byte("teams 1"))
+	o.Send([]byte("chat"))
+	if o.SendSnapshot("teams", []byte("teams 2")) || !o.closed() {
+		t.Fatalf("snapshot into a full queue: closed %v", o.closed())
+	}
+}
@@ -0,0 +1,21 @@
+package xoserver
+
+import (
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Пароли хранятся только в виде bcrypt-хеша: ни в памяти сервера, ни в файле состояния
+// самого пароля нет. bcrypt учитывает не больше 72 байт пароля, длиннее register не принимает.
+
+// passwordCost - сложность bcrypt. Тесты ее снижают, чтобы регистрация не занимала время.
+var passwordCost = bcrypt.DefaultCost
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	return string(hash), err
+}
+
+// checkPassword - подходит ли пароль к хешу, пустой хеш не подходит ни к чему
+func checkPassword(hash string, password string) bool {
+	return hash != "" && bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
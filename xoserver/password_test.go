@@ -0,0 +1,49 @@
+package xoserver
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func init() {
+	passwordCost = bcrypt.MinCost
+}
+
+func login(mem *Memory, username string, password string) map[string]any {
+	return newTestPlayer().send(mem, RequestParams{Method: "login", Username: username, Password: password})
+}
+
+func TestPasswordHashed(t *testing.T) {
+	config := testConfig()
+	config.StateFile = filepath.Join(t.TempDir(), "state.json")
+	mem := newTestMemory(t, config)
+	resp := newTestPlayer().send(mem, RequestParams{Method: "register", Username: "player", Password: "secret-pass"})
+	if resp["status"] != float64(StatusOk) {
+		t.Fatalf("register: %v", resp)
+	}
+	// Как будто игрок отключился
+	mem.Mutex.Lock()
+	mem.Sessions = map[string]*Session{}
+	mem.Mutex.Unlock()
+
+	if resp := login(mem, "player", "wrong-pass"); resp["code"] != CodeWrongCredentials {
+		t.Fatalf("login with a wrong password: %v", resp)
+	}
+	if resp := login(mem, "player", "secret-pass"); resp["status"] != float64(StatusOk) {
+		t.Fatalf("login: %v", resp)
+	}
+	if err := mem.flushState(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(config.StateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret-pass") || !strings.Contains(string(data), `"passwordhash": "$2a$`) {
+		t.Fatalf("state file:\n%s", data)
+	}
+}
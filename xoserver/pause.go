@@ -0,0 +1,122 @@
+package xoserver
+
+import (
+	"time"
+)
+
+// Пауза. Хозяин может остановить идущую игру: паузы между фазами замирают, ответы и голоса
+// не принимаются, пока он не снимет паузу. Пауза и ее конец попадают в историю игры.
+
+const pauseStepConst = 100 * time.Millisecond // с такой точностью waitGame замечает паузу
+
+type ResponseGamePaused struct {
+	Message  string `json:"message"` // gamepaused, gameresumed
+	Username string `json:"username"`
+}
+
+// waitGame ждет d игрового времени. Пока игра на паузе, время не идет.
+func (mem *Memory) waitGame(game *Game, d time.Duration) {
+	for {
+		mem.Mutex.Lock()
+		resume := game.Resume
+		mem.Mutex.Unlock()
+		if resume != nil {
+			<-resume
+			continue
+		}
+		if d <= 0 {
+			return
+		}
+		step := min(d, pauseStepConst)
+		mem.Clock.Sleep(step)
+		d -= step
+	}
+}
+
+// checkNotPaused отвечает клиенту ошибкой, если игра на паузе
+func (mem *Memory) checkNotPaused(req *Request, game *Game) bool {
+	mem.Mutex.Lock()
+	paused := game.Resume != nil
+	mem.Mutex.Unlock()
+	if paused {
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeGamePaused, "the game is paused"))
+		return false
+	}
+	return true
+}
+
+func (mem *Memory) pauseGameHandler(req *Request) {
+	session, err := mem.checkToken(req)
+	if err != nil {
+		req.Log.Error("invalid token", "err", err)
+		return
+	}
+	game := mem.hostGame(req, session)
+	if game == nil {
+		return
+	}
+	mem.Mutex.Lock()
+	if game.Phase == PhaseLobby {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeGameNotStarted, "game has not started yet"))
+		return
+	}
+	if game.Phase == PhaseEnded {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeGameEnded, "the game is over"))
+		return
+	}
+	if game.Resume != nil {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeGamePaused, "the game is already paused"))
+		return
+	}
+	game.Resume = make(chan struct{})
+	username := mem.addPauseHistory(game, session, "pause")
+	gameLog(game).Info("game paused", "username", username, "phase", game.Phase)
+	mem.Mutex.Unlock()
+
+	sendStatus(req, StatusOk)
+	mem.sendGameBroadcast(game, &ResponseGamePaused{Message: "gamepaused", Username: username})
+}
+
+func (mem *Memory) resumeGameHandler(req *Request) {
+	session, err := mem.checkToken(req)
+	if err != nil {
+		req.Log.Error("invalid token", "err", err)
+		return
+	}
+	game := mem.hostGame(req, session)
+	if game == nil {
+		return
+	}
+
+	mem.Mutex.Lock()
+	if game.Resume == nil {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeNotPaused, "the game is not paused"))
+		return
+	}
+	close(game.Resume)
+	game.Resume = nil
+	username := mem.addPauseHistory(game, session, "resume")
+	gameLog(game).Info("game resumed", "username", username, "phase", game.Phase)
+	mem.Mutex.Unlock()
+
+	sendStatus(req, StatusOk)
+	mem.sendGameBroadcast(game, &ResponseGamePaused{Message: "gameresumed", Username: username})
+}
+
+// addPauseHistory записывает паузу или ее конец в историю и возвращает имя хозяина.
+// Вызывается под mem.Mutex.
+func (mem *Memory) addPauseHistory(game *Game, session *Session, eventType string) string {
+	username := mem.Users[session.UserId].Username
+	game.History = append(game.History, &HistoryEvent{
+		Time:     mem.Clock.Now(),
+		Type:     eventType,
+		Username: username,
+		RoundNum: game.RoundNum,
+		DuelNum:  game.DuelNum,
+	})
+	return username
+}
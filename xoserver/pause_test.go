@@ -0,0 +1,151 @@
+package xoserver
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPauseGame(t *testing.T) {
+	mem, players := newVotingGame(t)
+	game := mem.Games[0]
+	host := players[0]
+	if game.HostId == "" || mem.Users[game.HostId].Username != "player0" {
+		t.Fatalf("host %q, want player0", game.HostId)
+	}
+
+	if resp := players[1].send(mem, RequestParams{Method: "pausegame"}); resp["code"] != CodeNotHost {
+		t.Fatalf("pausegame by a player: %v", resp)
+	}
+	if resp := host.send(mem, RequestParams{Method: "resumegame"}); resp["code"] != CodeNotPaused {
+		t.Fatalf("resumegame without a pause: %v", resp)
+	}
+	if resp := host.send(mem, RequestParams{Method: "pausegame"}); resp["status"] != float64(StatusOk) {
+		t.Fatalf("pausegame: %v", resp)
+	}
+	if resp := host.send(mem, RequestParams{Method: "pausegame"}); resp["code"] != CodeGamePaused {
+		t.Fatalf("second pausegame: %v", resp)
+	}
+	for _, p := range players {
+		if resp := p.send(mem, RequestParams{Method: "savevote", Vote: 0}); resp["code"] != CodeGamePaused && resp["code"] != CodeOwnDuel {
+			t.Fatalf("savevote on pause: %v", resp)
+		}
+	}
+
+	// Пока игра на паузе, паузы между фазами не кончаются, даже с FakeClock
+	done := make(chan struct{})
+	go func() {
+		mem.waitGame(game, time.Second)
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("waitGame returned during the pause")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if resp := host.send(mem, RequestParams{Method: "resumegame"}); resp["status"] != float64(StatusOk) {
+		t.Fatalf("resumegame: %v", resp)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("waitGame did not return after resume")
+	}
+
+	types := []string{}
+	for _, e := range game.History {
+		if e.Username == "player0" {
+			types = append(types, e.Type)
+		}
+	}
+	if len(types) != 2 || types[0] != "pause" || types[1] != "resume" {
+		t.Fatalf("history: %v", types)
+	}
+}
+
+// gateClock - игровые часы, которые стоят, пока тест не закроет Gate
+type gateClock struct {
+	*FakeClock
+	Gate chan struct{}
+}
+
+func (c gateClock) Sleep(d time.Duration) {
+	<-c.Gate
+	c.FakeClock.Sleep(d)
+}
+
+// gateConn не отдает записанное, пока тест не закроет Gate
+type gateConn struct {
+	net.Conn
+	Gate chan struct{}
+}
+
+func (c gateConn) Write(b []byte) (int, error) {
+	<-c.Gate
+	return c.Conn.Write(b)
+}
+
+// Пауза пришлась между началом игры и ответом бота: бот ждет конца паузы и доигрывает
+func TestPauseRematchWithBot(t *testing.T) {
+	mem, players := newEndedGame(t)
+	clock := gateClock{FakeClock: NewFakeClock(time.Now()), Gate: make(chan struct{})}
+	mem.Clock = clock
+	players[0].send(mem, RequestParams{Method: "playagain", Accept: true})
+	players[1].send(mem, RequestParams{Method: "playagain", Accept: true})
+	players[2].send(mem, RequestParams{Method: "playagain", Accept: false})
+
+	mem.Mutex.Lock()
+	rematch := mem.Games[1]
+	var bot *Session
+	for userId, sess := range rematch.Sessions {
+		if mem.Users[userId].Bot {
+			bot = sess
+		}
+	}
+	hostName := mem.Users[rematch.HostId].Username
+	mem.Mutex.Unlock()
+	if bot == nil {
+		t.Fatal("rematch without a bot")
+	}
+	host := players[0]
+	if hostName == "player1" {
+		host = players[1]
+	}
+
+	// Бот узнает о начале игры, только когда она уже на паузе
+	bot.Outbox.Mutex.Lock()
+	botConn := gateConn{Conn: bot.Outbox.Conn, Gate: make(chan struct{})}
+	bot.Outbox.Mutex.Unlock()
+	bot.Outbox.SetConn(botConn)
+	close(clock.Gate)
+	waitPhase(t, mem, rematch, PhaseAnswering)
+	if resp := host.send(mem, RequestParams{Method: "pausegame"}); resp["status"] != float64(StatusOk) {
+		t.Fatalf("pausegame: %v", resp)
+	}
+	close(botConn.Gate)
+	time.Sleep(20 * time.Millisecond)
+	mem.Mutex.Lock()
+	answered := rematch.QuestionNum[bot.UserId]
+	mem.Mutex.Unlock()
+	if answered != 0 {
+		t.Fatalf("bot answered %d questions on pause", answered)
+	}
+
+	if resp := host.send(mem, RequestParams{Method: "resumegame"}); resp["status"] != float64(StatusOk) {
+		t.Fatalf("resumegame: %v", resp)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mem.Mutex.Lock()
+		answered := rematch.QuestionNum[bot.UserId]
+		mem.Mutex.Unlock()
+		if answered == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("bot answered %d questions after resume, want 2", answered)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,155 @@
+package xoserver
+
+// Вопросы игроков. Пока комната собирается, каждый игрок может прислать до Config.PlayerPrompts
+// своих вопросов. generateDuels мешает их с вопросами из пакета и не дает игроку его собственный вопрос.
+// После игры игрок может сохранить свои вопросы в личный пакет.
+
+const maxPackPromptsConst = 50 // вопросов в личном пакете, старые вытесняются новыми
+
+type Prompt struct {
+	Text     string
+	UserId   string
+	Username string
+	Used     bool // уже был в дуэли
+}
+
+type ResponsePrompts struct {
+	Status  int64    `json:"status"`
+	Prompts []string `json:"prompts"`
+}
+
+func (mem *Memory) submitPromptHandler(req *Request) {
+	session, err := mem.checkToken(req)
+	if err != nil {
+		req.Log.Error("invalid token", "err", err)
+		return
+	}
+
+	mem.Mutex.Lock()
+	game := mem.Games[session.GameId]
+	username := mem.Users[session.UserId].Username
+	if game == nil {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeNotInGame, "enter a game first"))
+		return
+	}
+	promptsCnt, phase := game.PlayerPromptsCnt, game.Phase
+	mem.Mutex.Unlock()
+	if promptsCnt == 0 {
+		sendError(req, newError(ErrMethodIsNotAllowed, CodePromptsDisabled, "this room does not take player prompts"))
+		return
+	}
+	if phase != PhaseLobby && phase != PhaseStarting {
+		sendError(req, newError(ErrMethodIsNotAllowed, CodePromptsClosed, "prompts are taken only before the game starts"))
+		return
+	}
+	text, modErr := mem.Moderator.Check(ContentPrompt, username, req.Params.Text)
+	if modErr != nil {
+		sendError(req, modErr)
+		return
+	}
+
+	mem.Mutex.Lock()
+	submitted := int64(len(playerPrompts(game, session.UserId)))
+	if submitted >= game.PlayerPromptsCnt {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrAlreadyd, CodeTooManyPrompts, "you have already sent %d prompts", game.PlayerPromptsCnt))
+		return
+	}
+	game.Prompts = append(game.Prompts, &Prompt{Text: text, UserId: session.UserId, Username: username})
+	mem.Mutex.Unlock()
+	req.Log.Debug("prompt submitted", "username", username, "text", text)
+
+	sendStatus(req, StatusOk)
+}
+
+// savePromptsHandler добавляет вопросы игрока из только что закончившейся игры в его личный пакет
+func (mem *Memory) savePromptsHandler(req *Request) {
+	session, err := mem.checkToken(req)
+	if err != nil {
+		req.Log.Error("invalid token", "err", err)
+		return
+	}
+
+	mem.Mutex.Lock()
+	game := mem.Games[session.GameId]
+	mem.Mutex.Unlock()
+	if game == nil {
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeNotInGame, "enter a game first"))
+		return
+	}
+	if mem.gamePhase(game) != PhaseEnded {
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeGameNotEnded, "prompts can be saved after the game ends"))
+		return
+	}
+
+	mem.Mutex.Lock()
+	user := mem.Users[session.UserId]
+	for _, p := range playerPrompts(game, session.UserId) {
+		if !containsString(user.Prompts, p.Text) {
+			user.Prompts = append(user.Prompts, p.Text)
+		}
+	}
+	if len(user.Prompts) > maxPackPromptsConst {
+		user.Prompts = user.Prompts[len(user.Prompts)-maxPackPromptsConst:]
+	}
+	pack := append([]string{}, user.Prompts...)
+	mem.Mutex.Unlock()
+	mem.Store.MarkDirty()
+
+	sendData, err := req.Codec.Marshal(&ResponsePrompts{Status: StatusOk, Prompts: pack})
+	if err != nil {
+		req.Log.Error("marshal response", "err", err)
+	}
+	_, err = req.ConnReq.Write(sendData)
+	if err != nil {
+		req.Log.Error("write response", "err", err)
+	}
+}
+
+// playerPrompts - вопросы, присланные игроком в этой игре. Вызывается под mem.Mutex.
+func playerPrompts(game *Game, userId string) []*Prompt {
+	prompts := []*Prompt{}
+	for _, p := range game.Prompts {
+		if p.UserId == userId {
+			prompts = append(prompts, p)
+		}
+	}
+	return prompts
+}
+
+// takePlayerPrompts убирает из игры вопросы игрока и возвращает их. Вызывается под mem.Mutex.
+func takePlayerPrompts(game *Game, userId string) []*Prompt {
+	taken := []*Prompt{}
+	rest := []*Prompt{}
+	for _, p := range game.Prompts {
+		if p.UserId == userId {
+			taken = append(taken, p)
+		} else {
+			rest = append(rest, p)
+		}
+	}
+	game.Prompts = rest
+	return taken
+}
+
+// takePrompt - неиспользованный вопрос не от userId1 и не от userId2, nil, если такого нет.
+// Вызывается под mem.Mutex.
+func takePrompt(game *Game, userId1 string, userId2 string) *Prompt {
+	for _, p := range game.Prompts {
+		if !p.Used && p.UserId != userId1 && p.UserId != userId2 {
+			p.Used = true
+			return p
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
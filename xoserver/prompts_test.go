@@ -0,0 +1,105 @@
+package xoserver
+
+import (
+	"testing"
+)
+
+func TestPlayerPrompts(t *testing.T) {
+	config := testConfig()
+	config.MaxUsersCnt = 3
+	config.PlayerPrompts = 2
+	mem, players := newTestLobby(t, config, 3, 0)
+
+	if resp := players[0].send(mem, RequestParams{Method: "submitprompt", Text: "Вопрос до входа в комнату"}); resp["code"] != CodeNotInGame {
+		t.Fatalf("prompt before entergame: %v", resp)
+	}
+	if resp := players[0].send(mem, RequestParams{Method: "entergame"}); resp["prompts"] != float64(2) {
+		t.Fatalf("entergame: %v", resp)
+	}
+	players[1].send(mem, RequestParams{Method: "entergame"})
+
+	prompts := map[string]string{
+		"Худший подарок на новоселье":  "player0",
+		"Что нельзя говорить таксисту": "player0",
+		"Лучшее имя для кота-пирата":   "player1",
+	}
+	for text, username := range prompts {
+		p := players[0]
+		if username == "player1" {
+			p = players[1]
+		}
+		if resp := p.send(mem, RequestParams{Method: "submitprompt", Text: text}); resp["status"] != float64(StatusOk) {
+			t.Fatalf("submitprompt %q: %v", text, resp)
+		}
+	}
+	if resp := players[0].send(mem, RequestParams{Method: "submitprompt", Text: "Третий вопрос лишний"}); resp["code"] != CodeTooManyPrompts {
+		t.Fatalf("third prompt: %v", resp)
+	}
+	if resp := players[1].send(mem, RequestParams{Method: "submitprompt", Text: "Кот"}); resp["code"] != CodeTextTooShort {
+		t.Fatalf("short prompt: %v", resp)
+	}
+	if resp := players[0].send(mem, RequestParams{Method: "saveprompts"}); resp["code"] != CodeGameNotEnded {
+		t.Fatalf("saveprompts in the lobby: %v", resp)
+	}
+
+	players[2].send(mem, RequestParams{Method: "entergame"})
+	mem.Mutex.Lock()
+	game := mem.Games[0]
+	mem.Mutex.Unlock()
+	waitPhase(t, mem, game, PhaseAnswering)
+	if resp := players[2].send(mem, RequestParams{Method: "submitprompt", Text: "Вопрос после начала игры"}); resp["code"] != CodePromptsClosed {
+		t.Fatalf("prompt after the start: %v", resp)
+	}
+
+	// По вопросу игрока на раунд, и ни один не достается своему автору
+	used := map[string]bool{}
+	for round := int64(0); round < game.MaxRoundsCnt; round++ {
+		if round > 0 {
+			game.RoundNum = round
+			game.Duels = []*Duel{}
+			for _, session := range game.Sessions {
+				mem.generateDuels(session)
+				break
+			}
+		}
+		fromPlayers := 0
+		for _, duel := range game.Duels {
+			if duel.Author == "" {
+				continue
+			}
+			fromPlayers += 1
+			if prompts[duel.Question] != duel.Author {
+				t.Errorf("round %d: prompt %q by %s", round, duel.Question, duel.Author)
+			}
+			for _, username := range duel.Usernames {
+				if username == duel.Author {
+					t.Errorf("round %d: %s got their own prompt %q", round, username, duel.Question)
+				}
+			}
+			used[duel.Question] = true
+		}
+		if fromPlayers != 1 {
+			t.Errorf("round %d: %d player prompts, want 1", round, fromPlayers)
+		}
+	}
+	if len(used) != len(prompts) {
+		t.Errorf("used %d player prompts of %d", len(used), len(prompts))
+	}
+
+	// После игры вопросы сохраняются в личный пакет, повторно - без дублей
+	game.setPhase(PhaseEnded)
+	for i := 0; i < 2; i++ {
+		resp := players[0].send(mem, RequestParams{Method: "saveprompts"})
+		pack, _ := resp["prompts"].([]any)
+		if resp["status"] != float64(StatusOk) || len(pack) != 2 {
+			t.Fatalf("saveprompts: %v", resp)
+		}
+	}
+}
+
+func TestPlayerPromptsDisabled(t *testing.T) {
+	mem, players := newTestLobby(t, testConfig(), 1, 1)
+	if resp := players[0].send(mem, RequestParams{Method: "submitprompt", Text: "Вопрос в комнате без вопросов"}); resp["code"] != CodePromptsDisabled {
+		t.Fatalf("prompt in a room without player prompts: %v", resp)
+	}
+}
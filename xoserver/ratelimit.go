@@ -0,0 +1,225 @@
+package xoserver
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+type RateLimit struct {
+	Rate  float64 `json:"rate"`  // запросов в секунду
+	Burst float64 `json:"burst"` // сколько запросов можно сделать подряд
+}
+
+type RateLimitConfig struct {
+	Connection  RateLimit            `json:"connection"`  // все запросы одного соединения
+	Ip          RateLimit            `json:"ip"`          // все запросы со всех соединений одного ip
+	Methods     map[string]RateLimit `json:"methods"`     // отдельные методы в рамках соединения
+	MaxInFlight int64                `json:"maxinflight"` // обработчиков одного соединения одновременно
+	MaxStrikes  int64                `json:"maxstrikes"`  // превышений лимита до закрытия соединения
+	MaxLineLen  int64                `json:"maxlinelen"`  // байт в одном запросе
+}
+
+var defaultRateLimitConfig = RateLimitConfig{
+	Connection: RateLimit{Rate: 20, Burst: 40},
+	Ip:         RateLimit{Rate: 50, Burst: 100},
+	Methods: map[string]RateLimit{
+		"register":     {Rate: 0.2, Burst: 5},
+		"login":        {Rate: 0.2, Burst: 5},
+		"sendchat":     {Rate: 1, Burst: 3},
+		"react":        {Rate: 2, Burst: 5},
+		"submitprompt": {Rate: 1, Burst: 3},
+	},
+	MaxInFlight: 8,
+	MaxStrikes:  20,
+	MaxLineLen:  16 * 1024,
+}
+
+type TokenBucket struct {
+	Mutex  *sync.Mutex
+	Limit  RateLimit
+	Tokens float64
+	Last   time.Time
+}
+
+func newTokenBucket(limit RateLimit) *TokenBucket {
+	return &TokenBucket{
+		Mutex:  &sync.Mutex{},
+		Limit:  limit,
+		Tokens: limit.Burst,
+		Last:   time.Now(),
+	}
+}
+
+// Allow забирает один токен, если он есть. Нулевой лимит означает отсутствие ограничения.
+func (b *TokenBucket) Allow() bool {
+	b.Mutex.Lock()
+	defer b.Mutex.Unlock()
+	if b.Limit.Rate <= 0 {
+		return true
+	}
+	now := time.Now()
+	b.Tokens += now.Sub(b.Last).Seconds() * b.Limit.Rate
+	if b.Tokens > b.Limit.Burst {
+		b.Tokens = b.Limit.Burst
+	}
+	b.Last = now
+	if b.Tokens < 1 {
+		return false
+	}
+	b.Tokens -= 1
+	return true
+}
+
+type RateLimiter struct {
+	Mutex  *sync.Mutex
+	Config RateLimitConfig
+	Ips    map[string]*TokenBucket // ip -> bucket
+	Done   chan struct{}           // закрывается в Stop, останавливает cleanup
+}
+
+// ConnLimiter хранит лимиты одного клиентского соединения
+type ConnLimiter struct {
+	Mutex    *sync.Mutex
+	Limiter  *RateLimiter
+	Ip       string
+	Conn     *TokenBucket
+	Methods  map[string]*TokenBucket // method -> bucket
+	Strikes  int64
+	InFlight chan struct{}
+}
+
+func newRateLimiter(config RateLimitConfig) *RateLimiter {
+	l := &RateLimiter{
+		Mutex:  &sync.Mutex{},
+		Config: config,
+		Ips:    map[string]*TokenBucket{},
+		Done:   make(chan struct{}),
+	}
+	go l.cleanup()
+	return l
+}
+
+// cleanup удаляет корзины ip, которые давно не использовались
+func (l *RateLimiter) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.Done:
+			return
+		case <-ticker.C:
+		}
+		l.Mutex.Lock()
+		for ip, b := range l.Ips {
+			b.Mutex.Lock()
+			idle := time.Since(b.Last)
+			b.Mutex.Unlock()
+			if idle > 5*time.Minute {
+				delete(l.Ips, ip)
+			}
+		}
+		l.Mutex.Unlock()
+	}
+}
+
+// Stop останавливает очистку корзин. Лимитер после этого по-прежнему отвечает на Allow.
+func (l *RateLimiter) Stop() {
+	l.Mutex.Lock()
+	defer l.Mutex.Unlock()
+	select {
+	case <-l.Done:
+	default:
+		close(l.Done)
+	}
+}
+
+// SetConfig меняет лимиты. Уже созданные корзины соединений остаются прежними,
+// новые лимиты методов и ip действуют сразу.
+func (l *RateLimiter) SetConfig(config RateLimitConfig) {
+	l.Mutex.Lock()
+	l.Config = config
+	l.Ips = map[string]*TokenBucket{}
+	l.Mutex.Unlock()
+}
+
+func (l *RateLimiter) newConnLimiter(conn net.Conn) *ConnLimiter {
+	ip, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		ip = conn.RemoteAddr().String()
+	}
+	l.Mutex.Lock()
+	config := l.Config
+	l.Mutex.Unlock()
+	maxInFlight := config.MaxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = 1
+	}
+	return &ConnLimiter{
+		Mutex:    &sync.Mutex{},
+		Limiter:  l,
+		Ip:       ip,
+		Conn:     newTokenBucket(config.Connection),
+		Methods:  map[string]*TokenBucket{},
+		InFlight: make(chan struct{}, maxInFlight),
+	}
+}
+
+func (l *RateLimiter) allowIp(ip string) bool {
+	l.Mutex.Lock()
+	b, ok := l.Ips[ip]
+	if !ok {
+		b = newTokenBucket(l.Config.Ip)
+		l.Ips[ip] = b
+	}
+	l.Mutex.Unlock()
+	return b.Allow()
+}
+
+// Allow проверяет лимиты для очередного запроса и занимает место для его обработчика.
+// После обработки запроса нужно вызвать Done.
+func (c *ConnLimiter) Allow(method string) bool {
+	c.Limiter.Mutex.Lock()
+	methodLimit, hasMethodLimit := c.Limiter.Config.Methods[method]
+	c.Limiter.Mutex.Unlock()
+
+	c.Mutex.Lock()
+	methodBucket := c.Methods[method]
+	if methodBucket == nil && hasMethodLimit {
+		methodBucket = newTokenBucket(methodLimit)
+		c.Methods[method] = methodBucket
+	}
+	c.Mutex.Unlock()
+
+	allowed := c.Conn.Allow() && c.Limiter.allowIp(c.Ip)
+	if allowed && methodBucket != nil {
+		allowed = methodBucket.Allow()
+	}
+	if allowed {
+		select {
+		case c.InFlight <- struct{}{}:
+		default:
+			allowed = false
+		}
+	}
+	if !allowed {
+		c.Mutex.Lock()
+		c.Strikes += 1
+		c.Mutex.Unlock()
+	}
+	return allowed
+}
+
+func (c *ConnLimiter) Done() {
+	<-c.InFlight
+}
+
+// Abusive - соединение слишком часто превышало лимиты, его пора закрыть
+func (c *ConnLimiter) Abusive() bool {
+	c.Limiter.Mutex.Lock()
+	maxStrikes := c.Limiter.Config.MaxStrikes
+	c.Limiter.Mutex.Unlock()
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	return maxStrikes > 0 && c.Strikes >= maxStrikes
+}
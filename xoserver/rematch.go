@@ -0,0 +1,171 @@
+package xoserver
+
+// Реванш. После gameended игроки голосуют playagain. Если согласно больше половины, та же компания
+// играет еще раз с теми же настройками и без вопросов пакета, которые уже были. Места отказавшихся
+// занимают игроки из очереди, а если очереди нет - боты сервера.
+// Решение принимается, когда проголосовали все или прошло Config.RematchWait.
+
+type ResponsePlayAgain struct {
+	Message  string `json:"message"`
+	Username string `json:"username"`
+	Accept   bool   `json:"accept"`
+}
+
+type ResponseRematch struct {
+	Message   string   `json:"message"`
+	Usernames []string `json:"usernames"` // все игроки новой игры, вместе с ботами
+}
+
+func (mem *Memory) playAgainHandler(req *Request) {
+	session, err := mem.checkToken(req)
+	if err != nil {
+		req.Log.Error("invalid token", "err", err)
+		return
+	}
+
+	mem.Mutex.Lock()
+	game := mem.Games[session.GameId]
+	username := mem.Users[session.UserId].Username
+	if game == nil {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeNotInGame, "enter a game first"))
+		return
+	}
+	if game.Phase != PhaseEnded {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeGameNotEnded, "a rematch is offered after the game ends"))
+		return
+	}
+	if game.RematchDecided || mem.config().RematchWait == 0 {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeRematchOver, "rematch is already decided"))
+		return
+	}
+	if _, ok := game.Rematch[session.UserId]; ok {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrNotAcceptable, CodeAlreadyVoted, "you have already voted for a rematch"))
+		return
+	}
+	game.Rematch[session.UserId] = req.Params.Accept
+	everyoneVoted := len(game.Rematch) == len(mem.humanSessions(game))
+	mem.Mutex.Unlock()
+	req.Log.Info("rematch vote", "username", username, "accept", req.Params.Accept)
+
+	sendStatus(req, StatusOk)
+	mem.sendGameBroadcast(game, &ResponsePlayAgain{Message: "playagain", Username: username, Accept: req.Params.Accept})
+	if everyoneVoted {
+		mem.decideRematch(game)
+	}
+}
+
+// humanSessions - сессии комнаты без ботов. Вызывается под mem.Mutex.
+func (mem *Memory) humanSessions(game *Game) []*Session {
+	sessions := []*Session{}
+	for userId, sess := range game.Sessions {
+		if !mem.Users[userId].Bot {
+			sessions = append(sessions, sess)
+		}
+	}
+	return sessions
+}
+
+// decideRematch подводит итог голосования за реванш. Второй вызов ничего не делает.
+func (mem *Memory) decideRematch(game *Game) {
+	mem.Mutex.Lock()
+	if game.RematchDecided {
+		mem.Mutex.Unlock()
+		return
+	}
+	game.RematchDecided = true
+
+	// Согласие считается, только если игрок еще на связи и не ушел в другую комнату
+	humans := mem.humanSessions(game)
+	accepted := []*Session{}
+	for _, sess := range humans {
+		if game.Rematch[sess.UserId] && mem.Sessions[sess.UserId] == sess && sess.GameId == game.GameId {
+			accepted = append(accepted, sess)
+		}
+	}
+	if mem.Draining.Load() || len(accepted)*2 <= len(humans) {
+		mem.Mutex.Unlock()
+		gameLog(game).Info("rematch cancelled", "accepted", len(accepted), "players", len(humans))
+		mem.sendGameBroadcast(game, &ResponseBrcastMessage{Message: "rematchcancelled"})
+		return
+	}
+
+	rematch := mem.newGame(mem.lastGameId, game.Mode, game.MaxUsersCnt, game.MaxRoundsCnt, game.PlayerPromptsCnt, game.TeamsCnt)
+	for question := range game.UsedQuestions {
+		rematch.UsedQuestions[question] = true
+	}
+	// Хозяин остается хозяином, если тоже играет
+	for _, sess := range accepted {
+		if sess.UserId == game.HostId {
+			joinGame(rematch, sess)
+		}
+	}
+	for _, sess := range accepted {
+		if sess.UserId != game.HostId {
+			joinGame(rematch, sess)
+		}
+	}
+	// Команды те же, насколько получится: при старте их выровняют
+	for _, sess := range accepted {
+		username := mem.Users[sess.UserId].Username
+		if team, ok := game.Teams[username]; ok {
+			rematch.Teams[username] = team
+		}
+	}
+
+	// Свободные места - тем, кто ждет в собирающейся комнате, вместе с их вопросами.
+	// Сама комната переезжает на следующий номер, ее номер достается реваншу.
+	lobby := mem.Games[mem.lastGameId]
+	lobbyHost := ""
+	if lobby != nil && lobby.Phase == PhaseLobby {
+		for userId, sess := range lobby.Sessions {
+			if int64(len(rematch.Sessions)) >= rematch.MaxUsersCnt {
+				break
+			}
+			leaveGame(lobby, userId)
+			joinGame(rematch, sess)
+			if rematch.PlayerPromptsCnt > 0 {
+				rematch.Prompts = append(rematch.Prompts, takePlayerPrompts(lobby, userId)...)
+			}
+		}
+		if lobby.HostId != "" && lobby.Sessions[lobby.HostId] == nil {
+			lobby.HostId = mem.nextHost(lobby)
+			if lobby.HostId != "" {
+				lobbyHost = mem.Users[lobby.HostId].Username
+			}
+		}
+		lobby.GameId = mem.lastGameId + 1
+		for _, sess := range lobby.Sessions {
+			sess.GameId = lobby.GameId
+		}
+		mem.Games[lobby.GameId] = lobby
+	}
+	mem.Games[rematch.GameId] = rematch
+	mem.lastGameId += 1
+	botsCnt := rematch.MaxUsersCnt - int64(len(rematch.Sessions))
+	rematch.IsGameStarted = true
+	rematch.setPhase(PhaseStarting)
+	mem.Mutex.Unlock()
+
+	for i := int64(0); i < botsCnt; i++ {
+		mem.addBot(rematch)
+	}
+
+	mem.Mutex.Lock()
+	usernames := []string{}
+	var first *Session
+	for userId, sess := range rematch.Sessions {
+		usernames = append(usernames, mem.Users[userId].Username)
+		first = sess
+	}
+	mem.Mutex.Unlock()
+	gameLog(rematch).Info("rematch", "previous_game_id", game.GameId, "players", usernames, "bots", botsCnt)
+	mem.sendGameBroadcast(rematch, &ResponseRematch{Message: "rematch", Usernames: usernames})
+	if lobbyHost != "" {
+		mem.sendGameBroadcast(lobby, &ResponseNewHost{Message: "newhost", Username: lobbyHost})
+	}
+	go mem.delayedStartGame(first)
+}
@@ -0,0 +1,175 @@
+package xoserver
+
+import (
+	"testing"
+	"time"
+)
+
+// newEndedGame создает игру трех игроков и сразу ее заканчивает
+func newEndedGame(t *testing.T) (*Memory, []*testPlayer) {
+	t.Helper()
+	config := testConfig()
+	config.MaxUsersCnt = 3
+	mem, players := newTestLobby(t, config, 3, 3)
+	if resp := players[0].send(mem, RequestParams{Method: "playagain", Accept: true}); resp["code"] != CodeGameNotEnded {
+		t.Fatalf("playagain before the end: %v", resp)
+	}
+	mem.Mutex.Lock()
+	game := mem.Games[0]
+	mem.Mutex.Unlock()
+	waitPhase(t, mem, game, PhaseAnswering)
+	mem.Mutex.Lock()
+	game.setPhase(PhaseEnded)
+	mem.Mutex.Unlock()
+	return mem, players
+}
+
+func TestRematch(t *testing.T) {
+	mem, players := newEndedGame(t)
+
+	if resp := players[0].send(mem, RequestParams{Method: "playagain", Accept: true}); resp["status"] != float64(StatusOk) {
+		t.Fatalf("playagain: %v", resp)
+	}
+	if resp := players[0].send(mem, RequestParams{Method: "playagain", Accept: false}); resp["code"] != CodeAlreadyVoted {
+		t.Fatalf("second vote: %v", resp)
+	}
+	players[1].send(mem, RequestParams{Method: "playagain", Accept: true})
+	players[2].send(mem, RequestParams{Method: "playagain", Accept: true})
+
+	mem.Mutex.Lock()
+	game, rematch := mem.Games[0], mem.Games[1]
+	if rematch == nil || len(rematch.Sessions) != 3 {
+		mem.Mutex.Unlock()
+		t.Fatalf("rematch: %+v", rematch)
+	}
+	for userId := range game.Sessions {
+		if rematch.Sessions[userId] == nil || rematch.Sessions[userId].GameId != 1 {
+			t.Errorf("user %s is not in the rematch", userId)
+		}
+	}
+	if mem.lastGameId != 2 {
+		t.Errorf("lastGameId %d, want 2", mem.lastGameId)
+	}
+	mem.Mutex.Unlock()
+
+	// Вопросы пакета прошлой игры не повторяются
+	waitPhase(t, mem, rematch, PhaseAnswering)
+	mem.Mutex.Lock()
+	defer mem.Mutex.Unlock()
+	for _, duel := range rematch.Duels {
+		for _, old := range game.Duels {
+			if duel.Question == old.Question {
+				t.Errorf("question %q is repeated in the rematch", duel.Question)
+			}
+		}
+	}
+}
+
+func TestRematchFromQueue(t *testing.T) {
+	mem, players := newEndedGame(t)
+	waiting := newTestPlayer()
+	resp := waiting.send(mem, RequestParams{Method: "register", Username: "waiting", Password: "password"})
+	waiting.Token, _ = resp["token"].(string)
+	waiting.send(mem, RequestParams{Method: "entergame"})
+
+	players[0].send(mem, RequestParams{Method: "playagain", Accept: true})
+	players[1].send(mem, RequestParams{Method: "playagain", Accept: false})
+	players[2].send(mem, RequestParams{Method: "playagain", Accept: true})
+
+	// Реванш занимает номер собиравшейся комнаты, она переезжает на следующий
+	mem.Mutex.Lock()
+	defer mem.Mutex.Unlock()
+	rematch := mem.Games[1]
+	waitingId := ""
+	for userId, u := range mem.Users {
+		if u.Username == "waiting" {
+			waitingId = userId
+		}
+	}
+	if rematch == nil || len(rematch.Sessions) != 3 || rematch.Sessions[waitingId] == nil {
+		t.Fatalf("rematch: %+v", rematch)
+	}
+	lobby := mem.Games[2]
+	if lobby == nil || lobby.GameId != 2 || len(lobby.Sessions) != 0 || mem.lastGameId != 2 {
+		t.Fatalf("lobby after the rematch: %+v, lastGameId %d", lobby, mem.lastGameId)
+	}
+}
+
+func TestRematchWithBot(t *testing.T) {
+	mem, players := newEndedGame(t)
+	players[0].send(mem, RequestParams{Method: "playagain", Accept: true})
+	players[1].send(mem, RequestParams{Method: "playagain", Accept: true})
+	players[2].send(mem, RequestParams{Method: "playagain", Accept: false})
+
+	mem.Mutex.Lock()
+	rematch := mem.Games[1]
+	botId := ""
+	for userId := range rematch.Sessions {
+		if mem.Users[userId].Bot {
+			botId = userId
+		}
+	}
+	playersCnt := len(rematch.Sessions)
+	mem.Mutex.Unlock()
+	if botId == "" || playersCnt != 3 {
+		t.Fatalf("rematch without a bot: %d players", playersCnt)
+	}
+
+	// Бот сам отвечает на оба вопроса раунда
+	waitPhase(t, mem, rematch, PhaseAnswering)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mem.Mutex.Lock()
+		answered := rematch.QuestionNum[botId]
+		mem.Mutex.Unlock()
+		if answered == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("bot answered %d questions, want 2", answered)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRematchCancelled(t *testing.T) {
+	mem, players := newEndedGame(t)
+	players[1].send(mem, RequestParams{Method: "playagain", Accept: false})
+	players[2].send(mem, RequestParams{Method: "playagain", Accept: false})
+	// Время на голосование вышло, а players[0] так и не ответил
+	mem.Mutex.Lock()
+	game := mem.Games[0]
+	mem.Mutex.Unlock()
+	mem.decideRematch(game)
+
+	mem.Mutex.Lock()
+	decided, rematch := game.RematchDecided, mem.Games[1]
+	mem.Mutex.Unlock()
+	if !decided || rematch != nil {
+		t.Fatalf("rematch is not cancelled: %+v", rematch)
+	}
+	if resp := players[0].send(mem, RequestParams{Method: "playagain", Accept: true}); resp["code"] != CodeRematchOver {
+		t.Fatalf("vote after the decision: %v", resp)
+	}
+}
+
+// Когда время на реванш вышло, закончившаяся комната удаляется
+func TestEndedGameRemoved(t *testing.T) {
+	mem, players := newEndedGame(t)
+	players[1].send(mem, RequestParams{Method: "playagain", Accept: false})
+	mem.Mutex.Lock()
+	game := mem.Games[0]
+	mem.Mutex.Unlock()
+	mem.decideRematch(game)
+	mem.removeGame(game)
+
+	mem.Mutex.Lock()
+	removed := mem.Games[0] == nil
+	mem.Mutex.Unlock()
+	if !removed {
+		t.Fatal("ended game is not removed")
+	}
+	if resp := players[0].send(mem, RequestParams{Method: "playagain", Accept: true}); resp["code"] != CodeNotInGame {
+		t.Fatalf("playagain after the game is removed: %v", resp)
+	}
+}
@@ -0,0 +1,249 @@
+package xoserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+
+	"Xo-xo-touch/xocodec"
+)
+
+// RequestParams - разобранный и проверенный запрос. Поля, которых у метода нет, пустые.
+type RequestParams struct {
+	Method   string `json:"method"`
+	Token    string `json:"token"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Answer   string `json:"answer"`
+	Vote     int64  `json:"vote"`
+	Text     string `json:"text"`
+	Emoji    string `json:"emoji"`
+
+	Version      int64    `json:"version"`
+	Capabilities []string `json:"capabilities"`
+
+	Accept bool `json:"accept"`
+
+	// roomsettings, nil - не менять
+	MaxUsers  *int64 `json:"maxusers"`
+	MaxRounds *int64 `json:"maxrounds"`
+	Prompts   *int64 `json:"prompts"`
+	Teams     *int64 `json:"teams"`
+	Mode      string `json:"mode"` // пусто - не менять
+
+	Team string `json:"team"`
+}
+
+type fieldKind int
+
+const (
+	kindString fieldKind = iota
+	kindInt
+	kindStringList
+	kindBool
+)
+
+// FieldRule - требования к одному полю запроса
+type FieldRule struct {
+	Kind     fieldKind
+	Required bool
+	MaxLen   int   // байт, для строк и строк списка; 0 - без ограничения (длину текста проверяет модерация)
+	MaxItems int   // для списков
+	Min      int64 // для чисел
+	Max      int64
+}
+
+var (
+	tokenRule    = FieldRule{Kind: kindString, Required: true, MaxLen: 1024}
+	usernameRule = FieldRule{Kind: kindString, Required: true}
+	passwordRule = FieldRule{Kind: kindString, Required: true, MaxLen: 72} // больше bcrypt не учитывает
+)
+
+// requestSchemas - поля каждого метода. Метода нет в списке - запрос отклоняется,
+// поля нет в списке метода - тоже.
+var requestSchemas = map[string]map[string]FieldRule{
+	"hello": {
+		"version":      {Kind: kindInt, Required: true, Min: 1, Max: math.MaxInt32},
+		"capabilities": {Kind: kindStringList, MaxItems: 32, MaxLen: 64},
+	},
+	"register":       {"username": usernameRule, "password": passwordRule},
+	"login":          {"username": usernameRule, "password": passwordRule},
+	"getusername":    {"token": tokenRule},
+	"entergame":      {"token": tokenRule},
+	"getquestion":    {"token": tokenRule},
+	"saveanswer":     {"token": tokenRule, "answer": {Kind: kindString}},
+	"getduel":        {"token": tokenRule},
+	"savevote":       {"token": tokenRule, "vote": {Kind: kindInt, Required: true, Min: 0, Max: truthPosConst}}, // вариантов в дуэли bluff - три
+	"getduelresult":  {"token": tokenRule},
+	"getroundresult": {"token": tokenRule},
+	"getgameresult":  {"token": tokenRule},
+	"sendchat":       {"token": tokenRule, "text": {Kind: kindString}},
+	"react":          {"token": tokenRule, "emoji": {Kind: kindString}},
+	"submitprompt":   {"token": tokenRule, "text": {Kind: kindString}},
+	"saveprompts":    {"token": tokenRule},
+	"playagain":      {"token": tokenRule, "accept": {Kind: kindBool, Required: true}},
+	"kick":           {"token": tokenRule, "username": usernameRule},
+	"roomsettings": {
+		"token":     tokenRule,
+		"maxusers":  {Kind: kindInt, Min: minUsersCntConst, Max: int64(len(questions))},
+		"maxrounds": {Kind: kindInt, Min: 1, Max: maxRoomRoundsConst},
+		"prompts":   {Kind: kindInt, Min: 0, Max: maxPlayerPromptsConst},
+		"teams":     {Kind: kindInt, Min: 0, Max: int64(len(teamNames))},
+		"mode":      {Kind: kindString, MaxLen: 32},
+	},
+	"startgame":  {"token": tokenRule},
+	"pausegame":  {"token": tokenRule},
+	"resumegame": {"token": tokenRule},
+	"jointeam":   {"token": tokenRule, "team": {Kind: kindString, Required: true, MaxLen: 32}},
+}
+
+func badRequest(field string, format string, args ...any) *ResponseError {
+	e := newError(ErrBadRequest, CodeInvalidRequest, format, args...)
+	e.Field = field
+	return e
+}
+
+// readRequest читает один запрос: JSON - строку до '\n', MessagePack - один словарь.
+// MessagePack сразу переводится в JSON, дальше запросы обеих кодировок проверяются одинаково.
+// Запрос длиннее maxLen - xocodec.ErrTooLarge.
+func readRequest(r *bufio.Reader, maxLen int) ([]byte, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if xocodec.IsMsgpack(first[0]) {
+		frame, codec, err := xocodec.ReadFrame(r, maxLen)
+		if err != nil {
+			return nil, err
+		}
+		return xocodec.ToJSON(frame, codec)
+	}
+
+	line := []byte{}
+	for {
+		chunk, err := r.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(bytes.TrimRight(line, "\r\n")) > maxLen {
+			return nil, xocodec.ErrTooLarge
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		// Последняя строка может быть без '\n'
+		if err == io.EOF && len(line) > 0 {
+			err = nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r")), nil
+	}
+}
+
+// parseRequest разбирает строку запроса и проверяет ее по схеме метода.
+// Method в params заполнен, только если такой метод есть, даже когда в остальном запрос не прошел проверку.
+func parseRequest(data []byte) (*RequestParams, *ResponseError) {
+	params := &RequestParams{}
+	fields := map[string]json.RawMessage{}
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return params, badRequest("", "request is not a json object: %v", err)
+	}
+
+	rawMethod, ok := fields["method"]
+	if !ok {
+		return params, badRequest("method", "method is required")
+	}
+	method := ""
+	err = json.Unmarshal(rawMethod, &method)
+	if err != nil || isNull(rawMethod) {
+		return params, badRequest("method", "method must be a string")
+	}
+	schema, ok := requestSchemas[method]
+	if !ok {
+		e := newError(ErrUnknownMethod, CodeUnknownMethod, "unknown method %q", method)
+		e.Field = "method"
+		return params, e
+	}
+	params.Method = method
+
+	for name := range fields {
+		if _, ok := schema[name]; !ok && name != "method" {
+			return params, badRequest(name, "unknown field %q for method %s", name, method)
+		}
+	}
+	for name, rule := range schema {
+		raw, ok := fields[name]
+		if !ok {
+			if rule.Required {
+				return params, badRequest(name, "%s is required", name)
+			}
+			continue
+		}
+		reqErr := checkField(name, rule, raw)
+		if reqErr != nil {
+			return params, reqErr
+		}
+	}
+	// Все поля проверены и совпадают с тегами RequestParams
+	err = json.Unmarshal(data, params)
+	if err != nil {
+		return &RequestParams{}, badRequest("", "%v", err)
+	}
+	return params, nil
+}
+
+func isNull(raw json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
+
+// checkField проверяет тип и значение поля
+func checkField(name string, rule FieldRule, raw json.RawMessage) *ResponseError {
+	if isNull(raw) {
+		return badRequest(name, "%s must not be null", name)
+	}
+	switch rule.Kind {
+	case kindString:
+		s := ""
+		err := json.Unmarshal(raw, &s)
+		if err != nil {
+			return badRequest(name, "%s must be a string", name)
+		}
+		if rule.MaxLen > 0 && len(s) > rule.MaxLen {
+			return badRequest(name, "%s is longer than %d bytes", name, rule.MaxLen)
+		}
+	case kindInt:
+		n := int64(0)
+		err := json.Unmarshal(raw, &n)
+		if err != nil {
+			return badRequest(name, "%s must be an integer", name)
+		}
+		if n < rule.Min || n > rule.Max {
+			return badRequest(name, "%s must be from %d to %d", name, rule.Min, rule.Max)
+		}
+	case kindBool:
+		b := false
+		err := json.Unmarshal(raw, &b)
+		if err != nil {
+			return badRequest(name, "%s must be true or false", name)
+		}
+	case kindStringList:
+		list := []string{}
+		err := json.Unmarshal(raw, &list)
+		if err != nil {
+			return badRequest(name, "%s must be a list of strings", name)
+		}
+		if len(list) > rule.MaxItems {
+			return badRequest(name, "%s has more than %d items", name, rule.MaxItems)
+		}
+		for _, s := range list {
+			if len(s) > rule.MaxLen {
+				return badRequest(name, "%s has an item longer than %d bytes", name, rule.MaxLen)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+package xoserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"Xo-xo-touch/xocodec"
+)
+
+// testConn - соединение без сети: записанное копится в буфере, чтение сразу заканчивается
+type testConn struct {
+	Mutex *sync.Mutex
+	Buf   *bytes.Buffer
+}
+
+func newTestConn() *testConn {
+	return &testConn{Mutex: &sync.Mutex{}, Buf: &bytes.Buffer{}}
+}
+
+func (c *testConn) Read(b []byte) (int, error) { return 0, io.EOF }
+func (c *testConn) Write(b []byte) (int, error) {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	return c.Buf.Write(b)
+}
+func (c *testConn) Close() error                       { return nil }
+func (c *testConn) LocalAddr() net.Addr                { return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)} }
+func (c *testConn) RemoteAddr() net.Addr               { return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)} }
+func (c *testConn) SetDeadline(t time.Time) error      { return nil }
+func (c *testConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *testConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// Take возвращает все записанное с прошлого раза
+func (c *testConn) Take() []byte {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	data := bytes.Clone(c.Buf.Bytes())
+	c.Buf.Reset()
+	return data
+}
+
+type testPlayer struct {
+	Token      string
+	ConnReq    *testConn
+	ConnBrcast *testConn
+	Client     *ClientInfo
+	Last       []byte // ответы на последний call как есть
+}
+
+// call разбирает и выполняет запрос так же, как newClient, и возвращает ответы сервера
+func (p *testPlayer) call(mem *Memory, line string) []map[string]any {
+	params, reqErr := parseRequest([]byte(line))
+	req := &Request{
+		Method:     params.Method,
+		ConnReq:    p.ConnReq,
+		ConnBrcast: p.ConnBrcast,
+		Params:     params,
+		Client:     p.Client,
+		Codec:      p.Client.codec(),
+		Start:      time.Now(),
+		Log:        slog.Default(),
+	}
+	if reqErr != nil {
+		sendError(req, reqErr)
+	} else {
+		mem.handleRequest(req)
+	}
+
+	responses := []map[string]any{}
+	p.Last = p.ConnReq.Take()
+	reader := bufio.NewReader(bytes.NewReader(p.Last))
+	for {
+		frame, codec, err := xocodec.ReadFrame(reader, 0)
+		if err == io.EOF {
+			break
+		}
+		resp := map[string]any{}
+		if err == nil {
+			err = codec.Unmarshal(frame, &resp)
+		}
+		if err != nil {
+			responses = append(responses, map[string]any{"invalid": err.Error()})
+			break
+		}
+		responses = append(responses, resp)
+	}
+	return responses
+}
+
+func newTestPlayer() *testPlayer {
+	return &testPlayer{ConnReq: newTestConn(), ConnBrcast: newTestConn(), Client: newClientInfo()}
+}
+
+// testConfig - настройки без файлов и http
+func testConfig() *Config {
+	config := DefaultConfig()
+	config.StateFile = ""
+	config.HttpAddr = ""
+	config.BannedWordsFile = ""
+	config.LogLevel = "error"
+	return config
+}
+
+// newTestMemory создает сервер без сети с FakeClock
+func newTestMemory(t testing.TB, config *Config) *Memory {
+	t.Helper()
+	srv, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetClock(NewFakeClock(time.Now()))
+	t.Cleanup(srv.Mem.Limiter.Stop)
+	return srv.Mem
+}
+
+// send выполняет запрос params от имени игрока и возвращает первый ответ. Токен игрока подставляется сам,
+// а в запрос попадают только поля из схемы метода, как их отправил бы клиент.
+func (p *testPlayer) send(mem *Memory, params RequestParams) map[string]any {
+	params.Token = p.Token
+	data, err := json.Marshal(params)
+	if err != nil {
+		panic(err)
+	}
+	fields := map[string]json.RawMessage{}
+	json.Unmarshal(data, &fields)
+	schema := requestSchemas[params.Method]
+	for name, raw := range fields {
+		if _, ok := schema[name]; (!ok && name != "method") || isNull(raw) {
+			delete(fields, name)
+		}
+	}
+	line, _ := json.Marshal(fields)
+	return p.call(mem, string(line))[0]
+}
+
+func int64Param(v int64) *int64 {
+	return &v
+}
+
+// newTestLobby регистрирует игроков player0, player1, ... и первые entered из них входят в комнату
+func newTestLobby(t testing.TB, config *Config, cnt int, entered int) (*Memory, []*testPlayer) {
+	t.Helper()
+	mem := newTestMemory(t, config)
+	players := []*testPlayer{}
+	for i := 0; i < cnt; i++ {
+		p := newTestPlayer()
+		resp := p.send(mem, RequestParams{Method: "register", Username: fmt.Sprintf("player%d", i), Password: "password"})
+		token, _ := resp["token"].(string)
+		if token == "" {
+			t.Fatalf("register: %v", resp)
+		}
+		p.Token = token
+		players = append(players, p)
+	}
+	for i, p := range players[:entered] {
+		if resp := p.send(mem, RequestParams{Method: "entergame"}); resp["status"] != float64(StatusOk) {
+			t.Fatalf("player%d: entergame: %v", i, resp)
+		}
+	}
+	return mem, players
+}
+
+// waitPhase ждет, пока игра, которая идет в своих горутинах, дойдет до фазы phase
+func waitPhase(t testing.TB, mem *Memory, game *Game, phase string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		current := mem.gamePhase(game)
+		if current == phase {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("game %d: phase %s, want %s", game.GameId, current, phase)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// newVotingGame создает игру трех игроков, которые уже ответили на вопросы, так что идет голосование
+func newVotingGame(t testing.TB) (*Memory, []*testPlayer) {
+	t.Helper()
+	config := testConfig()
+	config.MaxUsersCnt = 3
+	mem, players := newTestLobby(t, config, 3, 3)
+
+	// Игра начинается в отдельной горутине, с FakeClock - сразу
+	mem.Mutex.Lock()
+	game := mem.Games[0]
+	mem.Mutex.Unlock()
+	waitPhase(t, mem, game, PhaseAnswering)
+
+	for i, p := range players {
+		for q := 0; q < 2; q++ {
+			p.send(mem, RequestParams{Method: "getquestion"})
+			resp := p.send(mem, RequestParams{Method: "saveanswer", Answer: fmt.Sprintf("answer %d %d", i, q)})
+			if resp["status"] != float64(StatusOk) {
+				t.Fatalf("saveanswer: %v", resp)
+			}
+		}
+	}
+	if phase := mem.gamePhase(game); phase != PhaseVoting {
+		t.Fatalf("game phase %s, want %s", phase, PhaseVoting)
+	}
+	return mem, players
+}
+
+func TestParseRequest(t *testing.T) {
+	tests := []struct {
+		data   string
+		status int64
+		field  string
+	}{
+		{`{"method": "savevote", "vote": 1, "token": "t"}`, StatusOk, ""},
+		{`{"method": "register", "username": "u", "password": "p"}`, StatusOk, ""},
+		{`{"method": "getduel", "token": "t"}`, StatusOk, ""},
+		{`{"method": "saveanswer", "token": "t"}`, StatusOk, ""},
+		{``, ErrBadRequest, ""},
+		{`[1, 2]`, ErrBadRequest, ""},
+		{`null`, ErrBadRequest, "method"},
+		{`{"token": "t"}`, ErrBadRequest, "method"},
+		{`{"method": 5}`, ErrBadRequest, "method"},
+		{`{"method": null}`, ErrBadRequest, "method"},
+		{`{"method": "dropdatabase"}`, ErrUnknownMethod, "method"},
+		{`{"method": "savevote", "vote": 5, "token": "t"}`, ErrBadRequest, "vote"},
+		{`{"method": "savevote", "vote": -1, "token": "t"}`, ErrBadRequest, "vote"},
+		{`{"method": "savevote", "vote": 0.5, "token": "t"}`, ErrBadRequest, "vote"},
+		{`{"method": "savevote", "vote": "1", "token": "t"}`, ErrBadRequest, "vote"},
+		{`{"method": "savevote", "token": "t"}`, ErrBadRequest, "vote"},
+		{`{"method": "savevote", "vote": 1}`, ErrBadRequest, "token"},
+		{`{"method": "getduel", "token": "t", "vote": 1}`, ErrBadRequest, "vote"},
+		{`{"method": "playagain", "accept": true, "token": "t"}`, StatusOk, ""},
+		{`{"method": "playagain", "accept": "yes", "token": "t"}`, ErrBadRequest, "accept"},
+		{`{"method": "playagain", "token": "t"}`, ErrBadRequest, "accept"},
+		{`{"method": "roomsettings", "maxrounds": 3, "prompts": 0, "token": "t"}`, StatusOk, ""},
+		{`{"method": "roomsettings", "maxusers": 100, "token": "t"}`, ErrBadRequest, "maxusers"},
+		{`{"method": "roomsettings", "teams": 5, "token": "t"}`, ErrBadRequest, "teams"},
+		{`{"method": "jointeam", "team": "red", "token": "t"}`, StatusOk, ""},
+		{`{"method": "jointeam", "token": "t"}`, ErrBadRequest, "team"},
+		{`{"method": "savevote", "vote": 2, "token": "t"}`, StatusOk, ""},
+		{`{"method": "savevote", "vote": 3, "token": "t"}`, ErrBadRequest, "vote"},
+		{`{"method": "roomsettings", "mode": "bluff", "token": "t"}`, StatusOk, ""},
+		{`{"method": "getduel", "token": "t", "Method": "register"}`, ErrBadRequest, "Method"},
+		{`{"method": "login", "username": "u", "password": 1}`, ErrBadRequest, "password"},
+		{`{"method": "login", "username": "u", "password": "` + strings.Repeat("p", 200) + `"}`, ErrBadRequest, "password"},
+		{`{"method": "sendchat", "token": "t", "text": null}`, ErrBadRequest, "text"},
+		{`{"method": "hello", "version": 2, "capabilities": ["chat", "msgpack"]}`, StatusOk, ""},
+		{`{"method": "hello", "version": 0}`, ErrBadRequest, "version"},
+		{`{"method": "hello", "version": 2, "capabilities": "chat"}`, ErrBadRequest, "capabilities"},
+		{`{"method": "hello", "version": 2, "capabilities": [1]}`, ErrBadRequest, "capabilities"},
+	}
+	for _, tt := range tests {
+		params, reqErr := parseRequest([]byte(tt.data))
+		if tt.status == StatusOk {
+			if reqErr != nil {
+				t.Errorf("%s: unexpected error %+v", tt.data, reqErr)
+			}
+			continue
+		}
+		if reqErr == nil {
+			t.Errorf("%s: accepted as %+v", tt.data, params)
+			continue
+		}
+		if reqErr.Status != tt.status || reqErr.Field != tt.field {
+			t.Errorf("%s: status %d field %q, want %d %q", tt.data, reqErr.Status, reqErr.Field, tt.status, tt.field)
+		}
+	}
+}
+
+func FuzzParseRequest(f *testing.F) {
+	f.Add([]byte(`{"method": "register", "username": "user", "password": "password"}`))
+	f.Add([]byte(`{"method": "savevote", "vote": 1, "token": "t"}`))
+	f.Add([]byte(`{"method": "savevote", "vote": 5, "token": "t"}`))
+	f.Add([]byte(`{"method": "saveanswer", "answer": "\u0000", "token": "t"}`))
+	f.Add([]byte(`{"method": "react", "emoji": "👍", "token": "t", "token": 1}`))
+	f.Add([]byte(`{"method": "`))
+	f.Add([]byte(`{}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		params, reqErr := parseRequest(data)
+		if params == nil {
+			t.Fatal("params is nil")
+		}
+		if reqErr != nil {
+			if reqErr.Status != ErrBadRequest && reqErr.Status != ErrUnknownMethod {
+				t.Fatalf("status %d", reqErr.Status)
+			}
+			_, err := json.Marshal(reqErr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return
+		}
+		if _, ok := requestSchemas[params.Method]; !ok {
+			t.Fatalf("accepted unknown method %q", params.Method)
+		}
+		if params.Vote < 0 || params.Vote > truthPosConst {
+			t.Fatalf("accepted vote %d", params.Vote)
+		}
+	})
+}
+
+// FuzzHandleRequest шлет запросы в идущую игру. TOKEN в запросе заменяется на токен игрока.
+func FuzzHandleRequest(f *testing.F) {
+	mem, players := newVotingGame(f)
+	for _, method := range requestMethods {
+		f.Add(uint8(0), `{"method": "`+method+`", "token": "TOKEN"}`)
+	}
+	f.Add(uint8(0), `{"method": "savevote", "vote": 5, "token": "TOKEN"}`)
+	f.Add(uint8(1), `{"method": "savevote", "vote": 1, "token": "TOKEN"}`)
+	f.Add(uint8(2), `{"method": "savevote", "vote": 0, "token": "TOKEN"}`)
+	f.Add(uint8(2), `{"method": "savevote", "vote": 2, "token": "TOKEN"}`)
+	f.Add(uint8(0), `{"method": "saveanswer", "answer": "late", "token": "TOKEN"}`)
+	f.Add(uint8(1), `{"method": "sendchat", "text": "hello", "token": "TOKEN"}`)
+	f.Add(uint8(2), `{"method": "react", "emoji": "😂", "token": "TOKEN"}`)
+	f.Add(uint8(0), `{"method": "login", "username": "player0", "password": "password"}`)
+	f.Add(uint8(0), `{"method": "getduel", "token": "not a jwt"}`)
+	f.Add(uint8(1), `{"method": "hello", "version": 2, "capabilities": ["chat"]}`)
+	f.Fuzz(func(t *testing.T, player uint8, line string) {
+		p := players[int(player)%len(players)]
+		line = strings.ReplaceAll(line, "TOKEN", p.Token)
+		for _, resp := range p.call(mem, line) {
+			if _, ok := resp["invalid"]; ok {
+				t.Fatalf("%s: invalid response: %v", line, resp["invalid"])
+			}
+			status, ok := resp["status"]
+			if !ok {
+				t.Fatalf("%s: response without status: %v", line, resp)
+			}
+			// Любая ошибка - с кодом, сообщением и методом
+			code, _ := resp["code"].(string)
+			message, _ := resp["message"].(string)
+			_, hasMethod := resp["method"]
+			if status != float64(StatusOk) && (code == "" || message == "" || !hasMethod) {
+				t.Fatalf("%s: error without code, message or method: %v", line, resp)
+			}
+		}
+	})
+}
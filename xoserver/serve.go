@@ -0,0 +1,120 @@
+// Package xoserver - игровой сервер Xo-xo-touch.
+//
+// Клиент подключается к двум портам: на порт запросов шлет запросы и получает ответы,
+// с порта рассылок получает события своей игры. Server поднимает оба порта и http с метриками,
+// его можно запустить и в тесте: порт 0 - любой свободный, а FakeClock убирает паузы игры.
+package xoserver
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type Server struct {
+	Mem        *Memory
+	LnReq      net.Listener
+	LnBrcast   net.Listener
+	LnHttp     net.Listener
+	HttpServer *http.Server
+}
+
+// New создает сервер и загружает сохраненное состояние. Слушать порты он начинает в Start.
+func New(config *Config) (*Server, error) {
+	mem := &Memory{
+		Mutex:      &sync.Mutex{},
+		Users:      map[string]*User{},
+		Sessions:   map[string]*Session{},
+		lastGameId: 0,
+		Games:      map[int64]*Game{},
+		Conns:      map[int64][]net.Conn{},
+		Store:      newStore(config.StateFile),
+		Clock:      realClock{},
+	}
+	mem.applyConfig(config)
+	err := mem.loadState()
+	if err != nil {
+		return nil, err
+	}
+	return &Server{Mem: mem}, nil
+}
+
+// SetClock подменяет часы игры, до Start
+func (s *Server) SetClock(clock Clock) {
+	s.Mem.Clock = clock
+}
+
+func (s *Server) Config() *Config {
+	return s.Mem.config()
+}
+
+// Reload применяет новые настройки без перезапуска (кроме портов и файлов)
+func (s *Server) Reload(config *Config) {
+	s.Mem.applyConfig(config)
+}
+
+// Start открывает порты и начинает принимать клиентов
+func (s *Server) Start() error {
+	config := s.Mem.config()
+	tlsConfig, err := newTlsConfig(config.TlsCertFile, config.TlsKeyFile)
+	if err != nil {
+		return err
+	}
+	s.LnReq, err = listen(config.PortReq, tlsConfig)
+	if err != nil {
+		return err
+	}
+	s.LnBrcast, err = listen(config.PortBrcast, tlsConfig)
+	if err != nil {
+		s.LnReq.Close()
+		return err
+	}
+	slog.Info("listening", "req", s.ReqAddr(), "brcast", s.BrcastAddr(), "tls", tlsConfig != nil)
+
+	// HTTP: метрики, проверки живости и тексты на проверку модератору
+	if config.HttpAddr != "" {
+		s.LnHttp, err = net.Listen("tcp", config.HttpAddr)
+		if err != nil {
+			s.LnReq.Close()
+			s.LnBrcast.Close()
+			return err
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics)
+		mux.HandleFunc("/healthz", s.Mem.healthzHandler)
+		mux.HandleFunc("/readyz", s.Mem.readyzHandler)
+		mux.HandleFunc("/moderation/flags", s.Mem.moderationFlagsHandler)
+		s.HttpServer = &http.Server{Handler: mux}
+		go func() {
+			err := s.HttpServer.Serve(s.LnHttp)
+			if !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("http server stopped", "addr", config.HttpAddr, "err", err)
+			}
+		}()
+	}
+
+	if config.StateFile != "" {
+		go s.Mem.flushStatePeriodically(10 * time.Second)
+	}
+	go s.Mem.acceptClients(s.LnReq, s.LnBrcast)
+	return nil
+}
+
+func (s *Server) ReqAddr() string {
+	return s.LnReq.Addr().String()
+}
+
+func (s *Server) BrcastAddr() string {
+	return s.LnBrcast.Addr().String()
+}
+
+// Shutdown доигрывает идущие игры (не дольше grace), сохраняет состояние и закрывает соединения
+func (s *Server) Shutdown(grace time.Duration) {
+	s.Mem.shutdown([]net.Listener{s.LnReq, s.LnBrcast}, grace)
+	if s.HttpServer != nil {
+		s.HttpServer.Close()
+	}
+}
@@ -0,0 +1,1509 @@
+package xoserver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"log/slog"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"Xo-xo-touch/xocodec"
+)
+
+const (
+	maxUsersCntConst         = 5
+	sleepBetweenConst        = 2
+	portReqConst             = 8081
+	portBrcastConst          = 8082
+	printRequestsToSendConst = false
+	maxRoundsCntConst        = 3
+	startDelayConst          = 3
+	bannedWordsFileConst     = "badwords.txt"
+	logLevelConst            = "info"
+	logFormatConst           = "text"
+	httpAddrConst            = ":8090"
+	stateFileConst           = "state.json"
+	shutdownGraceConst       = 60
+	playerPromptsConst       = 0
+	maxPlayerPromptsConst    = 2
+	rematchWaitConst         = 30
+	endedGameKeepConst       = 30 // seconds, столько хранится закончившаяся игра, если реванши выключены
+	minUsersCntConst         = 3  // без третьего игрока за дуэль некому голосовать
+	maxRoomRoundsConst       = 10 // больше раундов хозяин комнаты не поставит
+	teamsConst               = 0
+	minTeamUsersConst        = 4 // командная игра - от 4 до 8 игроков
+	maxTeamUsersConst        = 8
+)
+
+const (
+	StatusOk              = 200
+	ErrAlreadyd           = 409
+	ErrBadRequest         = 400
+	ErrInvalidData        = 401
+	ErrAlreadyLoggedIn    = 403
+	ErrUnknownMethod      = 404
+	ErrMethodIsNotAllowed = 405
+	ErrNotAcceptable      = 406
+	ErrTooLarge           = 413
+	ErrUpgradeRequired    = 426
+	ErrTooManyRequests    = 429
+	ErrUnavailable        = 503
+)
+
+type User struct {
+	Username     string `json:"username"`
+	PasswordHash string `json:"passwordhash"` // bcrypt, см. hashPassword
+	UserId       string
+	Prompts      []string `json:"prompts,omitempty"` // личный пакет вопросов (saveprompts)
+	Bot          bool     `json:"-"`                 // бот сервера, не сохраняется
+
+	Rating      int64 `json:"rating"`      // средние очки за игру, по ним делятся команды
+	GamesPlayed int64 `json:"gamesplayed"` // сыграно игр до конца
+}
+
+type Session struct {
+	Mutex      *sync.Mutex
+	UserId     string
+	ConnReq    net.Conn
+	ConnBrcast net.Conn
+	Outbox     *Outbox
+	Client     *ClientInfo // по нему выбирается кодировка рассылок
+	GameId     int64       // как и соединения и Client, под mem.Mutex
+}
+
+func (mem *Memory) newSession(userId string, connReq net.Conn, connBrcast net.Conn, client *ClientInfo) *Session {
+	return &Session{
+		Mutex:      &sync.Mutex{},
+		UserId:     userId,
+		ConnReq:    connReq,
+		ConnBrcast: connBrcast,
+		Client:     client,
+		Outbox:     newOutbox(connBrcast, mem.config().Outbox, slog.With("user_id", userId)),
+		GameId:     -1,
+	}
+}
+
+type Duel struct {
+	Question  string             `json:"question"`
+	Usernames []string           `json:"usernames"`
+	Answers   []string           `json:"answers"`
+	Votes     map[int64][]string `json:"votes"`             // posInDuel -> array of username voted
+	Author    string             `json:"author"`            // кто прислал вопрос, пусто - вопрос из пакета
+	Truth     string             `json:"truth,omitempty"`   // bluff: верный ответ из пакета
+	Choices   []int64            `json:"choices,omitempty"` // bluff: порядок вариантов в getduel, позиция в дуэли или truthPosConst
+}
+
+// Game - комната. Ее поля, как и Session.GameId, читаются и меняются только под mem.Mutex.
+type Game struct {
+	GameId           int64
+	Mode             GameMode
+	Sessions         map[string]*Session // userId -> session
+	IsGameStarted    bool
+	Duels            []*Duel
+	QuestionNum      map[string]int64 // userId -> questionNum
+	IsVoted          map[string]bool  // userId -> isVoted
+	DuelNum          int64
+	MaxUsersCnt      int64
+	MaxRoundsCnt     int64
+	RoundNum         int64
+	EveryoneAnswered bool
+	DuelVotingEnded  bool
+	RoundResult      map[int64]map[string]int64 // roundNum - username -> points
+	GameResult       map[string]int64           // username -> points
+	TeamsCnt         int64                      // сколько команд, 0 - каждый сам за себя
+	Teams            map[string]string          // username -> команда; в лобби - выбор игрока, с начала игры - у всех
+	TeamRoundResult  map[int64]map[string]int64 // roundNum - команда -> points
+	TeamGameResult   map[string]int64           // команда -> points
+	ResultDuel       *Duel                      // последняя дуэль, голосование за которую закончилось
+	ResultRoundNum   int64                      // последний раунд, голосование в котором закончилось
+	History          []*HistoryEvent
+	PlayerPromptsCnt int64           // сколько вопросов может прислать каждый игрок, 0 - не принимаются
+	Prompts          []*Prompt       // вопросы игроков
+	UsedQuestions    map[string]bool // вопросы пакета, которые уже были у этой компании, в том числе в прошлых играх
+	Rematch          map[string]bool // userId -> согласен ли на реванш (playagain)
+	RematchDecided   bool
+	Resume           chan struct{}   // не nil, пока игра на паузе; закрывается, когда хозяин ее снимает
+	HostId           string          // userId хозяина комнаты, пусто - хозяина нет
+	Joined           []string        // userId в порядке входа, по нему роль хозяина переходит дальше
+	Kicked           map[string]bool // userId выгнанных хозяином, обратно в эту комнату не пускают
+	Phase            string
+	PhaseStartedAt   time.Time
+	Clock            Clock
+}
+
+const (
+	PhaseLobby        = "lobby"
+	PhaseStarting     = "starting"
+	PhaseAnswering    = "answering"
+	PhaseVoting       = "voting"
+	PhaseRoundResults = "roundresults"
+	PhaseEnded        = "ended"
+)
+
+// setPhase переводит игру в новую фазу и учитывает время, проведенное в прошлой.
+// Вызывается под mem.Mutex.
+func (game *Game) setPhase(phase string) {
+	if game.Phase != "" {
+		metrics.RoomsByPhase.Dec(game.Phase)
+		metrics.PhaseDuration.Observe(game.Clock.Now().Sub(game.PhaseStartedAt).Seconds(), game.Phase)
+	}
+	game.Phase = phase
+	game.PhaseStartedAt = game.Clock.Now()
+	metrics.RoomsByPhase.Inc(phase)
+}
+
+// gamePhase - фаза игры, прочитанная под mem.Mutex
+func (mem *Memory) gamePhase(game *Game) string {
+	mem.Mutex.Lock()
+	defer mem.Mutex.Unlock()
+	return game.Phase
+}
+
+type Memory struct {
+	Mutex      *sync.Mutex
+	Users      map[string]*User // userId -> user
+	Games      map[int64]*Game  // gameId -> game
+	lastGameId int64
+	Sessions   map[string]*Session // userIs -> sessison
+	Moderator  *Moderator
+	Limiter    *RateLimiter
+	Config     atomic.Pointer[Config]
+	lastConnId atomic.Int64
+	Conns      map[int64][]net.Conn // connId -> request and broadcast connections
+	Store      *Store
+	Draining   atomic.Bool
+	Clock      Clock
+}
+
+type ResponseToken struct {
+	Status int64  `json:"status"`
+	Token  string `json:"token"`
+}
+
+type ResponseUsername struct {
+	Status   int64  `json:"status"`
+	Username string `json:"username"`
+}
+
+type ResponseNewPlayer struct {
+	Message  string `json:"message"`
+	Username string `json:"username"`
+}
+
+type ResponseGamePlayers struct {
+	Status    int64    `json:"status"`
+	Usernames []string `json:"usernames"`
+	Mode      string   `json:"mode"`            // режим игры: classic, bluff
+	Prompts   int64    `json:"prompts"`         // сколько вопросов может прислать каждый игрок (submitprompt), 0 - нисколько
+	Host      string   `json:"host"`            // хозяин комнаты
+	Teams     []string `json:"teams,omitempty"` // команды, в которые можно войти (jointeam)
+}
+
+type ResponseBrcastMessage struct {
+	Message string `json:"message"`
+}
+
+type ResponseQuestion struct {
+	Status   int64  `json:"status"`
+	Question string `json:"question"`
+}
+
+type ResponseDuel struct {
+	Status   int64    `json:"status"`
+	Question string   `json:"question"`
+	Answers  []string `json:"answers"`
+	DuelNum  int64    `json:"duelnum"`
+}
+
+type ResponseDuelResult struct {
+	Status    int64    `json:"status"`
+	Question  string   `json:"question"`
+	Usernames []string `json:"usernames"`
+	Answers   []string `json:"answers"`
+	VotesFor0 []string `json:"votesfor0"`
+	VotesFor1 []string `json:"votesfor1"`
+	Author    string   `json:"author"` // кто прислал вопрос, пусто - вопрос из пакета
+
+	Truth         string   `json:"truth,omitempty"`         // bluff: верный ответ
+	VotesForTruth []string `json:"votesfortruth,omitempty"` // bluff: кто его нашел
+}
+
+type ResponseRoundResult struct {
+	Status int64            `json:"status"`
+	Points map[string]int64 `json:"points"`
+	Teams  map[string]int64 `json:"teams,omitempty"` // очки команд, если игра командная
+}
+
+type UserJWT struct {
+	Username string `json:"username"`
+	UserId   string `json:"id"`
+}
+
+type UserJWTClaims struct {
+	User UserJWT `json:"user"`
+	jwt.StandardClaims
+}
+
+var tokenSecret = []byte("super secret")
+
+func (mem *Memory) registerHandler(req *Request) {
+	// Get data
+	u := User{Username: req.Params.Username}
+
+	// Check username is acceptable
+	username, modErr := mem.Moderator.Check(ContentUsername, u.Username, u.Username)
+	if modErr != nil {
+		req.Log.Warn("username is not acceptable", "username", u.Username, "code", modErr.Code)
+		sendError(req, modErr)
+		return
+	}
+	u.Username = username
+
+	// Хеш считается долго, поэтому до mem.Mutex
+	hash, err := hashPassword(req.Params.Password)
+	if err != nil {
+		req.Log.Error("hash password", "err", err)
+		sendError(req, badRequest("password", "password can not be used: %v", err))
+		return
+	}
+	u.PasswordHash = hash
+
+	// Check if user is already d
+	mem.Mutex.Lock()
+	for _, v := range mem.Users {
+		if u.Username == v.Username {
+			mem.Mutex.Unlock()
+			req.Log.Warn("username is already registered", "username", u.Username)
+			sendError(req, newError(ErrAlreadyd, CodeUsernameTaken, "username %s is already taken", u.Username))
+			return
+		}
+	}
+
+	// Create user and session
+	u.UserId = uuid.New().String()
+	mem.Users[u.UserId] = &u
+	mem.Sessions[u.UserId] = mem.newSession(u.UserId, req.ConnReq, req.ConnBrcast, req.Client)
+	mem.Mutex.Unlock()
+	mem.Store.MarkDirty()
+
+	req.Log = req.Log.With("user_id", u.UserId)
+	req.Log.Info("user registered", "username", u.Username)
+
+	// Create and send JWT token
+	token := createToken(u.UserId, u.Username)
+	sendData, err := req.Codec.Marshal(&ResponseToken{Status: StatusOk, Token: token})
+	if err != nil {
+		req.Log.Error("marshal response", "err", err)
+	}
+	_, err = req.ConnReq.Write(sendData)
+	if err != nil {
+		req.Log.Error("write response", "err", err)
+	}
+
+	//fmt.Printf("{\"method\": \"entergame\", \"token\": \"%s\"}\n\n", token)
+	if mem.config().PrintRequestsToSend {
+		fmt.Println("{" +
+			"\"method\": \"entergame\",              \"token\": \"" + token + "\"}\n" +
+			"{\"method\": \"getquestion\",           \"token\": \"" + token + "\"}\n" +
+			"{\"method\": \"saveanswer\", \"answer\":\"my answer\" ,\"token\": \"" + token + "\"}\n" +
+			"{\"method\": \"getduel\",               \"token\": \"" + token + "\"}\n" +
+			"{\"method\": \"savevote\", \"vote\": 1, \"token\": \"" + token + "\"}\n" +
+			"{\"method\": \"getduelresult\",         \"token\": \"" + token + "\"}\n")
+	}
+}
+
+func (mem *Memory) loginHandler(req *Request) {
+	// Get data
+	u := User{Username: req.Params.Username}
+
+	// Check user exists. Хеш сравнивается долго, поэтому не под mem.Mutex.
+	mem.Mutex.Lock()
+	hash := ""
+	for _, v := range mem.Users {
+		if u.Username == v.Username && !v.Bot {
+			hash = v.PasswordHash
+			break
+		}
+	}
+	mem.Mutex.Unlock()
+	if !checkPassword(hash, req.Params.Password) {
+		req.Log.Warn("wrong username or password", "username", u.Username)
+		sendError(req, newError(ErrInvalidData, CodeWrongCredentials, "wrong username or password"))
+		return
+	}
+
+	// Check user is not logged in
+	mem.Mutex.Lock()
+	for _, v := range mem.Users {
+		if u.Username == v.Username && mem.Sessions[v.UserId] != nil {
+			mem.Mutex.Unlock()
+			req.Log.Warn("username is already logged in", "username", u.Username)
+			sendError(req, newError(ErrAlreadyLoggedIn, CodeAlreadyLoggedIn, "%s is already logged in from another connection", u.Username))
+			return
+		}
+	}
+
+	// Create session
+	userId := ""
+	for _, v := range mem.Users {
+		if u.Username == v.Username {
+			userId = v.UserId
+		}
+	}
+	mem.Sessions[userId] = mem.newSession(userId, req.ConnReq, req.ConnBrcast, req.Client)
+	mem.Mutex.Unlock()
+	req.Log = req.Log.With("user_id", userId)
+	req.Log.Info("user logged in", "username", u.Username)
+
+	// Create and send JWT token
+	token := createToken(userId, u.Username)
+	sendData, err := req.Codec.Marshal(&ResponseToken{Status: StatusOk, Token: token})
+	if err != nil {
+		req.Log.Error("marshal response", "err", err)
+	}
+	_, err = req.ConnReq.Write(sendData)
+	if err != nil {
+		req.Log.Error("write response", "err", err)
+	}
+}
+
+func createToken(userId string, username string) string {
+	token := jwt.NewWithClaims(
+		jwt.SigningMethodHS256,
+		UserJWTClaims{
+			User: UserJWT{
+				UserId:   userId,
+				Username: username,
+			},
+		},
+	)
+	tokenString, err := token.SignedString(tokenSecret)
+	if err != nil {
+		slog.Error("sign token", "user_id", userId, "err", err)
+	}
+	return tokenString
+}
+
+func (mem *Memory) checkToken(req *Request) (*Session, error) {
+	tokenString := req.Params.Token
+
+	// Check
+	hashSecretGetter := func(token *jwt.Token) (interface{}, error) {
+		method, ok := token.Method.(*jwt.SigningMethodHMAC)
+		if !ok || method.Alg() != "HS256" {
+			return nil, fmt.Errorf("bad sign method")
+		}
+		return tokenSecret, nil
+	}
+	token, err := jwt.ParseWithClaims(tokenString, &UserJWTClaims{}, hashSecretGetter)
+	if err != nil || !token.Valid {
+		sendError(req, newError(ErrInvalidData, CodeInvalidToken, "token is not valid, log in again"))
+		return nil, fmt.Errorf("jwt validation error")
+	}
+
+	payload, ok := token.Claims.(*UserJWTClaims)
+	if !ok {
+		sendError(req, newError(ErrInvalidData, CodeInvalidToken, "token has no user, log in again"))
+		return nil, fmt.Errorf("no payload")
+	}
+
+	userId := payload.User.UserId
+
+	// Если пришел токен, но нет такого юзера (не зарегистрирован или не вошел)
+	mem.Mutex.Lock()
+	if mem.Users[userId] == nil {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrInvalidData, CodeUnknownUser, "user is not registered, register again"))
+		return nil, fmt.Errorf("ERROR JWT token failed: This user is not logged in")
+	}
+
+	// Если соединение потеряно, но есть верный токен, то создать новую сессию
+	if mem.Sessions[userId] == nil {
+		mem.Sessions[userId] = mem.newSession(userId, req.ConnReq, req.ConnBrcast, req.Client)
+	}
+
+	session := mem.Sessions[userId]
+	req.withSession(session)
+	mem.Mutex.Unlock()
+	return session, nil
+}
+
+func (mem *Memory) getUsernameHandler(req *Request) {
+	session, err := mem.checkToken(req)
+	if err != nil {
+		req.Log.Error("invalid token", "err", err)
+		return
+	}
+	session.Mutex.Lock()
+	userId := session.UserId
+	session.Mutex.Unlock()
+	mem.Mutex.Lock()
+	sendData, err := req.Codec.Marshal(&ResponseUsername{Status: StatusOk, Username: mem.Users[userId].Username})
+	if err != nil {
+		req.Log.Error("marshal response", "err", err)
+	}
+	mem.Mutex.Unlock()
+	_, err = req.ConnReq.Write(sendData)
+	if err != nil {
+		req.Log.Error("write response", "err", err)
+	}
+}
+
+func (mem *Memory) enterGameHandler(req *Request) {
+	session, err := mem.checkToken(req)
+	if err != nil {
+		req.Log.Error("invalid token", "err", err)
+		return
+	}
+	session.Mutex.Lock()
+	userId := session.UserId
+	session.Mutex.Unlock()
+
+	// Сервер останавливается, новые комнаты не создаются и не заполняются
+	if mem.Draining.Load() {
+		sendError(req, newError(ErrUnavailable, CodeServerShuttingDown, "server is shutting down, no new games"))
+		return
+	}
+
+	// If connection was lost (на всякий случай)
+	session.Outbox.SetConn(req.ConnBrcast)
+	mem.Mutex.Lock()
+	session.ConnReq = req.ConnReq
+	session.ConnBrcast = req.ConnBrcast
+	session.Client = req.Client
+
+	lastGame := mem.Games[mem.lastGameId]
+	if lastGame != nil && lastGame.Kicked[userId] {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeKicked, "you were kicked from this room, try again when it starts"))
+		return
+	}
+
+	// [0 в комнате] Предыдущая комната начала игру -> Создать новую игру
+	if lastGame == nil {
+		//fmt.Println("GAME CREATED")
+		//fmt.Println("LASTGAMEID", mem.lastGameId)
+		config := mem.config()
+		mem.Games[mem.lastGameId] = mem.newGame(mem.lastGameId, gameModes[config.Mode], config.MaxUsersCnt, config.MaxRoundsCnt, config.PlayerPrompts, config.Teams)
+		lastGame = mem.Games[mem.lastGameId]
+		//fmt.Println("GAMES", mem.Games[0])
+	}
+
+	// [0-2 из 3 в комнате]
+	// Разослать всем имя нового игрока
+	usernamesIn := []string{}
+	username := mem.Users[userId].Username
+	for _, sess := range lastGame.Sessions {
+		sendData, err := sess.Client.codec().Marshal(&ResponseNewPlayer{Message: "newplayer", Username: username})
+		if err != nil {
+			req.Log.Error("marshal response", "err", err)
+		}
+		//sendData = append(sendData, []byte("\n")...)
+		sess.Outbox.Send(sendData)
+		usernamesIn = append(usernamesIn, mem.Users[sess.UserId].Username)
+	}
+	// Сохранить сессию нового игрока в эту игру, а номер игры - в сессию
+	joinGame(lastGame, session)
+
+	// Отослать новому игроку список тех, кто уже в комнате
+	players := &ResponseGamePlayers{
+		Status:    StatusOk,
+		Usernames: usernamesIn,
+		Mode:      lastGame.Mode.Name(),
+		Prompts:   lastGame.PlayerPromptsCnt,
+		Host:      mem.Users[lastGame.HostId].Username,
+		Teams:     teamNames[:lastGame.TeamsCnt],
+	}
+	gameId := lastGame.GameId
+	usersCnt := int64(len(lastGame.Sessions))
+	maxUsersCnt := lastGame.MaxUsersCnt
+	mem.Mutex.Unlock()
+	sendData, err := req.Codec.Marshal(players)
+	if err != nil {
+		req.Log.Error("marshal response", "err", err)
+	}
+	//sendData = append(sendData, []byte("\n")...)
+	_, err = req.ConnReq.Write(sendData)
+	if err != nil {
+		req.Log.Error("write response", "err", err)
+	}
+
+	// [2 из 3 в комнате] Начать игру
+	req.Log.Info("player entered game", "entered_game_id", gameId, "players", usersCnt, "maxplayers", maxUsersCnt)
+	if usersCnt == maxUsersCnt {
+		mem.startLobby(lastGame, session)
+	}
+}
+
+// startLobby закрывает набор в собирающуюся комнату и начинает игру с теми, кто в ней есть.
+// Комнату могут начать одновременно заполнение, хозяин и его настройки: начинает первый,
+// для остальных комната уже не собирается, и startLobby ничего не делает и возвращает false.
+func (mem *Memory) startLobby(game *Game, session *Session) bool {
+	mem.Mutex.Lock()
+	if game.Phase != PhaseLobby {
+		mem.Mutex.Unlock()
+		return false
+	}
+	game.MaxUsersCnt = int64(len(game.Sessions))
+	game.IsGameStarted = true
+	game.setPhase(PhaseStarting)
+	mem.lastGameId += 1
+	mem.Mutex.Unlock()
+	go mem.delayedStartGame(session)
+	return true
+}
+
+// newGame создает комнату, которая собирает игроков
+func (mem *Memory) newGame(gameId int64, mode GameMode, maxUsersCnt int64, maxRoundsCnt int64, playerPromptsCnt int64, teamsCnt int64) *Game {
+	game := &Game{
+		GameId:           gameId,
+		Mode:             mode,
+		Sessions:         map[string]*Session{},
+		IsGameStarted:    false,
+		QuestionNum:      map[string]int64{},
+		IsVoted:          map[string]bool{},
+		DuelNum:          0,
+		MaxUsersCnt:      maxUsersCnt,
+		MaxRoundsCnt:     maxRoundsCnt,
+		RoundNum:         0,
+		EveryoneAnswered: false,
+		DuelVotingEnded:  false,
+		RoundResult:      map[int64]map[string]int64{},
+		GameResult:       map[string]int64{},
+		TeamsCnt:         teamsCnt,
+		Teams:            map[string]string{},
+		TeamRoundResult:  map[int64]map[string]int64{},
+		TeamGameResult:   map[string]int64{},
+		History:          []*HistoryEvent{},
+		PlayerPromptsCnt: playerPromptsCnt,
+		Prompts:          []*Prompt{},
+		UsedQuestions:    map[string]bool{},
+		Rematch:          map[string]bool{},
+		Joined:           []string{},
+		Kicked:           map[string]bool{},
+		Clock:            mem.Clock,
+	}
+	game.setPhase(PhaseLobby)
+	return game
+}
+
+// joinGame сажает игрока в комнату. Первый вошедший становится ее хозяином.
+func joinGame(game *Game, session *Session) {
+	session.GameId = game.GameId
+	game.Sessions[session.UserId] = session
+	game.QuestionNum[session.UserId] = 0
+	game.Joined = append(game.Joined, session.UserId)
+	if game.HostId == "" {
+		game.HostId = session.UserId
+	}
+}
+
+// leaveGame убирает игрока из комнаты, которая еще собирается
+func leaveGame(game *Game, userId string) {
+	delete(game.Sessions, userId)
+	delete(game.QuestionNum, userId)
+	joined := []string{}
+	for _, u := range game.Joined {
+		if u != userId {
+			joined = append(joined, u)
+		}
+	}
+	game.Joined = joined
+}
+
+var questions = []string{
+	//"question1?",
+	//"question2?",
+	//"question3?",
+	//"question4?",
+	//"question5?",
+	"В плохом офисе вид из окна на _____",
+	"Без чего не обходится деревенская свадьба?",
+	"О чем мечтает робот-пылесос, пока заряжыется?",
+	"Взятка?! Разве считается взяткой то, что я просто дал судье _____?",
+	"Название планеты, полностью покрытой кукурузой",
+	"Удивительная вещь, которую можно найти застрявшей в паутине в вашем подвале",
+	"Даже за 10 миллионов рублей ты не наколешь эту фразу у себя на спине",
+	"Водителям на зметку: Не стоит управлять машиной и _____ одновременно",
+	"Твоя квартира рельно большая, если у тебя есть комната специально для _____",
+	"В будущем Америка переименуется в _____",
+}
+
+func (mem *Memory) sendBroadcastMessage(session *Session, message string) {
+	mem.sendBroadcast(session, &ResponseBrcastMessage{Message: message})
+}
+
+// sendBroadcast рассылает всем в комнате session. Очереди сессий не блокируют,
+// поэтому рассылка идет целиком под mem.Mutex: вызывающий его не держит.
+func (mem *Memory) sendBroadcast(session *Session, v interface{}) {
+	mem.Mutex.Lock()
+	game := mem.Games[session.GameId]
+	mem.Mutex.Unlock()
+	mem.sendGameBroadcast(game, v)
+}
+
+// sendGameBroadcast рассылает всем в комнате game, даже если сессии уже перешли в другую.
+// Очереди сессий не блокируют, поэтому рассылка идет целиком под mem.Mutex: вызывающий его не держит.
+func (mem *Memory) sendGameBroadcast(game *Game, v interface{}) {
+	mem.Mutex.Lock()
+	defer mem.Mutex.Unlock()
+	mem.sendGameBroadcastLocked(game, v)
+}
+
+// sendGameBroadcastLocked - то же, что sendGameBroadcast. Вызывается под mem.Mutex.
+func (mem *Memory) sendGameBroadcastLocked(game *Game, v interface{}) {
+	// Кодируется по разу на кодировку, а не на игрока
+	encoded := map[xocodec.Codec][]byte{}
+	for _, sess := range game.Sessions {
+		codec := sess.Client.codec()
+		if _, ok := encoded[codec]; ok {
+			continue
+		}
+		sendData, err := codec.Marshal(v)
+		if err != nil {
+			gameLog(game).Error("marshal broadcast", "err", err, "encoding", codec.Name())
+		}
+		encoded[codec] = sendData
+	}
+	gameLog(game).Debug("broadcast", "data", v)
+	// Каждая сессия пишет в свое соединение сама, так что рассылка идет параллельно
+	snapshot := snapshotKind(v)
+	for _, sess := range game.Sessions {
+		if snapshot != "" {
+			sess.Outbox.SendSnapshot(snapshot, encoded[sess.Client.codec()])
+		} else {
+			sess.Outbox.Send(encoded[sess.Client.codec()])
+		}
+	}
+}
+
+// generateDuels делит игроков на пары дуэлей нового раунда. Вызывается под mem.Mutex.
+func (mem *Memory) generateDuels(session *Session) {
+	game := mem.Games[session.GameId]
+	userIds := []string{}
+	for u := range game.Sessions {
+		userIds = append(userIds, u)
+	}
+	rand.Shuffle(len(userIds), func(i, j int) { userIds[i], userIds[j] = userIds[j], userIds[i] })
+	// Соседи по кругу дуэлей - из разных команд
+	if game.TeamsCnt > 0 {
+		userIds = interleaveTeams(game, mem.usernames(userIds))
+	}
+
+	// Вопросы игроков делятся поровну между оставшимися раундами, остальные дуэли - с вопросами из пакета.
+	// Комната без вопросов игроков, в том числе bluff, где нужен верный ответ, играет только пакетом.
+	rand.Shuffle(len(game.Prompts), func(i, j int) { game.Prompts[i], game.Prompts[j] = game.Prompts[j], game.Prompts[i] })
+	unusedCnt := int64(0)
+	for _, p := range game.Prompts {
+		if !p.Used && game.PlayerPromptsCnt > 0 {
+			unusedCnt += 1
+		}
+	}
+	roundsLeft := game.MaxRoundsCnt - game.RoundNum
+	promptsCnt := (unusedCnt + roundsLeft - 1) / roundsLeft
+
+	round := map[string]bool{}
+	q := int64(0)
+	for i := range userIds {
+		userId1 := userIds[i]
+		userId2 := userIds[(i+1)%len(userIds)]
+		username1 := mem.Users[userId1].Username
+		username2 := mem.Users[userId2].Username
+		duel := &Duel{
+			Usernames: []string{username1, username2},
+			Answers:   make([]string, 2),
+			Votes:     map[int64][]string{},
+		}
+		// Свой вопрос игроку не достается
+		if promptsCnt > 0 {
+			if p := takePrompt(game, userId1, userId2); p != nil {
+				duel.Question = p.Text
+				duel.Author = p.Username
+				promptsCnt -= 1
+			}
+		}
+		if duel.Question == "" {
+			game.Mode.FillQuestion(game, duel, game.RoundNum*game.MaxUsersCnt+q, round)
+		}
+		q += 1
+		game.Duels = append(game.Duels, duel)
+	}
+}
+
+// packQuestion - вопрос из пакета pack, которого у этой компании еще не было, начиная с номера start.
+// Когда пакет кончается, вопросы идут по второму кругу, но в одном раунде (round) не повторяются.
+// Вызывается под mem.Mutex.
+func packQuestion(game *Game, pack []string, start int64, round map[string]bool) string {
+	for pass := 0; pass < 2; pass++ {
+		for i := int64(0); i < int64(len(pack)); i++ {
+			question := pack[(start+i)%int64(len(pack))]
+			if game.UsedQuestions[question] || round[question] {
+				continue
+			}
+			game.UsedQuestions[question] = true
+			round[question] = true
+			return question
+		}
+		game.UsedQuestions = map[string]bool{}
+	}
+	// Игроков больше, чем вопросов в пакете; Config.Validate этого не допускает
+	return pack[start%int64(len(pack))]
+}
+
+// initResults заводит нулевые очки раунда и игры. Вызывается под mem.Mutex.
+func (mem *Memory) initResults(session *Session) {
+	game := mem.Games[session.GameId]
+	if game.RoundResult[game.RoundNum] == nil {
+		game.RoundResult[game.RoundNum] = map[string]int64{}
+		for _, sess := range game.Sessions {
+			usernameIn := mem.Users[sess.UserId].Username
+			game.RoundResult[game.RoundNum][usernameIn] = 0
+		}
+	}
+	// Очки игры копятся все раунды
+	for _, sess := range game.Sessions {
+		usernameIn := mem.Users[sess.UserId].Username
+		if _, ok := game.GameResult[usernameIn]; !ok {
+			game.GameResult[usernameIn] = 0
+		}
+	}
+	// Очки команд - рядом с очками игроков
+	if game.TeamsCnt > 0 && game.TeamRoundResult[game.RoundNum] == nil {
+		game.TeamRoundResult[game.RoundNum] = map[string]int64{}
+		for _, team := range teamNames[:game.TeamsCnt] {
+			game.TeamRoundResult[game.RoundNum][team] = 0
+			if _, ok := game.TeamGameResult[team]; !ok {
+				game.TeamGameResult[team] = 0
+			}
+		}
+	}
+}
+
+func (mem *Memory) delayedStartGame(session *Session) {
+	mem.Mutex.Lock()
+	game := mem.Games[session.GameId]
+	mem.Mutex.Unlock()
+	mem.waitGame(game, seconds(mem.config().StartDelay))
+	mem.Mutex.Lock()
+	var teams map[string][]string
+	if game.TeamsCnt > 0 {
+		teams = mem.assignTeams(game)
+	}
+	// Дуэли готовы до рассылки, иначе быстрый клиент спросит вопрос раньше времени
+	mem.generateDuels(session)
+	mem.initResults(session)
+	game.setPhase(PhaseAnswering)
+	mem.Mutex.Unlock()
+	if teams != nil {
+		mem.sendGameBroadcast(game, &ResponseTeams{Message: "teams", Members: teams})
+	}
+	mem.sendBroadcastMessage(session, "gamestarted")
+	metrics.GamesStarted.Inc()
+	gameLog(game).Info("game started")
+}
+
+// startedGame - игра сессии, если она уже началась. Иначе отвечает ErrMethodIsNotAllowed и возвращает nil.
+func (mem *Memory) startedGame(req *Request, session *Session) *Game {
+	mem.Mutex.Lock()
+	game := mem.Games[session.GameId]
+	started := game != nil && game.Phase != PhaseLobby && game.Phase != PhaseStarting
+	mem.Mutex.Unlock()
+	if game == nil {
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeNotInGame, "enter a game first"))
+		return nil
+	}
+	if !started {
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeGameNotStarted, "game has not started yet"))
+		return nil
+	}
+	return game
+}
+
+func getDuelsByUsername(username string, game *Game) []*Duel {
+	userDuels := []*Duel{}
+	for _, duel := range game.Duels {
+		for _, usernameInDuel := range duel.Usernames {
+			if usernameInDuel == username {
+				userDuels = append(userDuels, duel)
+			}
+		}
+	}
+	return userDuels
+}
+
+func (mem *Memory) getQuestionHandler(req *Request) {
+	session, err := mem.checkToken(req)
+	if err != nil {
+		req.Log.Error("invalid token", "err", err)
+		return
+	}
+
+	game := mem.startedGame(req, session)
+	if game == nil {
+		return
+	}
+	session.Mutex.Lock()
+	userId := session.UserId
+	session.Mutex.Unlock()
+	mem.Mutex.Lock()
+	duels := getDuelsByUsername(mem.Users[userId].Username, game)
+	// На все вопросы раунда уже есть ответы
+	questionNum := game.QuestionNum[userId]
+	if questionNum >= int64(len(duels)) {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeAlreadyAnswered, "all questions of the round are answered"))
+		return
+	}
+	question := duels[questionNum].Question
+	mem.Mutex.Unlock()
+	sendData, err := req.Codec.Marshal(&ResponseQuestion{
+		Status:   StatusOk,
+		Question: question,
+	})
+	if err != nil {
+		req.Log.Error("marshal response", "err", err)
+	}
+	_, err = req.ConnReq.Write(sendData)
+	if err != nil {
+		req.Log.Error("write response", "err", err)
+	}
+}
+
+func getPosInDuelByUsername(username string, duel *Duel) int64 {
+	for i, u := range duel.Usernames {
+		if u == username {
+			return int64(i)
+		}
+	}
+	return -1
+}
+
+// sendStatus отвечает статусом без данных. Ошибки отправляет sendError.
+func sendStatus(req *Request, status int64) {
+	sendData, err := req.Codec.Marshal(&struct {
+		Status int64 `json:"status"`
+	}{
+		Status: status,
+	})
+	if err != nil {
+		req.Log.Error("marshal response", "err", err)
+	}
+	_, err = req.ConnReq.Write(sendData)
+	if err != nil {
+		req.Log.Error("write response", "err", err)
+	}
+}
+
+func (mem *Memory) saveAnswerHandler(req *Request) {
+	session, err := mem.checkToken(req)
+	if err != nil {
+		req.Log.Error("invalid token", "err", err)
+		return
+	}
+	session.Mutex.Lock()
+	userId := session.UserId
+	session.Mutex.Unlock()
+	game := mem.startedGame(req, session)
+	if game == nil {
+		return
+	}
+
+	if !mem.checkNotPaused(req, game) {
+		return
+	}
+
+	answer := req.Params.Answer
+
+	mem.Mutex.Lock()
+	// Нельзя голосовать за оба ответа
+	if game.IsVoted[userId] {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrNotAcceptable, CodeAlreadyVoted, "answers can not be changed after voting"))
+		return
+	}
+	username := mem.Users[userId].Username
+	duels := getDuelsByUsername(username, game)
+	questionNum := game.QuestionNum[userId]
+
+	// Нельзя отвечать больше, чем на два вопроса
+	if questionNum >= int64(len(duels)) {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeAlreadyAnswered, "all questions of the round are answered"))
+		return
+	}
+
+	// Ответ проходит через модерацию
+	answerText, modErr := mem.Moderator.Check(ContentAnswer, username, answer)
+	if modErr != nil {
+		mem.Mutex.Unlock()
+		sendError(req, modErr)
+		return
+	}
+	answer = answerText
+	if modeErr := game.Mode.CheckAnswer(duels[questionNum], answer); modeErr != nil {
+		mem.Mutex.Unlock()
+		sendError(req, modeErr)
+		return
+	}
+
+	//fmt.Println("questionNum =", questionNum)
+	posInDuel := getPosInDuelByUsername(mem.Users[userId].Username, duels[questionNum])
+	duels[questionNum].Answers[posInDuel] = answer
+	game.QuestionNum[userId] += 1 // до ответа клиенту, чтоб следующий getquestion дал новый вопрос
+	mem.Mutex.Unlock()
+	req.Log.Debug("answer saved", "username", username, "question", duels[questionNum].Question, "answer", answer)
+
+	// Ответ клиенту
+	lastAnswer := false
+	if questionNum == 1 {
+		lastAnswer = true
+	}
+	sendData, err := req.Codec.Marshal(&struct {
+		Status     int64 `json:"status"`
+		LastAnswer bool  `json:"lastanswer"`
+	}{
+		Status:     StatusOk,
+		LastAnswer: lastAnswer,
+	})
+	if err != nil {
+		req.Log.Error("marshal response", "err", err)
+	}
+	_, err = req.ConnReq.Write(sendData)
+	if err != nil {
+		req.Log.Error("write response", "err", err)
+	}
+
+	// Броадкаст о том, что все ответили. Последние ответы могут прийти одновременно,
+	// голосование начинает только один из них.
+	mem.Mutex.Lock()
+	everyoneAnswered := !game.EveryoneAnswered
+	for _, sess := range game.Sessions {
+		if game.QuestionNum[sess.UserId] != 2 {
+			everyoneAnswered = false
+		}
+	}
+	if everyoneAnswered {
+		for _, duel := range game.Duels {
+			game.Mode.PrepareVoting(duel)
+		}
+		game.EveryoneAnswered = true
+		game.setPhase(PhaseVoting)
+	}
+	mem.Mutex.Unlock()
+	if everyoneAnswered {
+		mem.sendBroadcastMessage(session, "everyoneanswered")
+		req.Log.Info("everyone answered")
+	}
+}
+
+func (mem *Memory) getDuelHandler(req *Request) {
+	session, err := mem.checkToken(req)
+	if err != nil {
+		req.Log.Error("invalid token", "err", err)
+		return
+	}
+
+	game := mem.startedGame(req, session)
+	if game == nil {
+		return
+	}
+	mem.Mutex.Lock()
+	// Нельзя голосовать, пока все не ответили на вопросы
+	if !game.EveryoneAnswered {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeNotEveryoneAnswered, "voting starts when everyone answers"))
+		return
+	}
+	// Нельзя голосовать после конца голосования
+	if game.DuelNum == game.MaxUsersCnt {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeVotingOver, "voting in this round is over"))
+		return
+	}
+	duel := game.Duels[game.DuelNum]
+	resp := &ResponseDuel{
+		Status:   StatusOk,
+		Question: duel.Question,
+		Answers:  game.Mode.Options(duel),
+		DuelNum:  game.DuelNum,
+	}
+	mem.Mutex.Unlock()
+
+	sendData, err := req.Codec.Marshal(resp)
+	if err != nil {
+		req.Log.Error("marshal response", "err", err)
+	}
+	_, err = req.ConnReq.Write(sendData)
+	if err != nil {
+		req.Log.Error("write response", "err", err)
+	}
+}
+
+func (mem *Memory) saveVoteHandler(req *Request) {
+	session, err := mem.checkToken(req)
+	if err != nil {
+		req.Log.Error("invalid token", "err", err)
+		return
+	}
+	session.Mutex.Lock()
+	userId := session.UserId
+	session.Mutex.Unlock()
+
+	game := mem.startedGame(req, session)
+	if game == nil {
+		return
+	}
+	if !mem.checkNotPaused(req, game) {
+		return
+	}
+	mem.Mutex.Lock()
+	// Нельзя голосовать, пока все не ответили на вопросы
+	if !game.EveryoneAnswered {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeNotEveryoneAnswered, "voting starts when everyone answers"))
+		return
+	}
+	// Нельзя голосовать после конца голосования
+	if game.DuelNum == game.MaxUsersCnt {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeVotingOver, "voting in this round is over"))
+		return
+	}
+	duel := game.Duels[game.DuelNum]
+	username := mem.Users[userId].Username
+
+	// Нельзя голосовать за вопрос, на который ты отвечал
+	if duel.Usernames[0] == username || duel.Usernames[1] == username {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrNotAcceptable, CodeOwnDuel, "you can not vote in your own duel"))
+		return
+	}
+	// Один голос за дуэль
+	if game.IsVoted[userId] {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrNotAcceptable, CodeAlreadyVoted, "you have already voted in this duel"))
+		return
+	}
+
+	// Голос - номер варианта из getduel, вариантов в режимах разное число
+	vote := req.Params.Vote
+	if optionsCnt := len(game.Mode.Options(duel)); vote >= int64(optionsCnt) {
+		mem.Mutex.Unlock()
+		sendError(req, badRequest("vote", "there are only %d answers to vote for", optionsCnt))
+		return
+	}
+	req.Log.Debug("vote saved", "username", username, "duelnum", game.DuelNum, "vote", vote)
+
+	// Режим записывает голос и добавляет очки в результат раунда и игры
+	game.Mode.Vote(game, duel, username, vote)
+	game.IsVoted[userId] = true
+
+	// Если все проголосовали за дуэль, то выбираем следующую дуэль. + Броадкаст
+	duelVotingEnded := game.ResultDuel != duel
+	for _, sess := range game.Sessions {
+		usernameIn := mem.Users[sess.UserId].Username
+		if duel.Usernames[0] == usernameIn || duel.Usernames[1] == usernameIn {
+			continue
+		}
+		//fmt.Println(duel.Usernames[0], "VS", duel.Usernames[1], "VOTER =", usernameIn)
+		userVoted := game.IsVoted[sess.UserId]
+		if !userVoted {
+			duelVotingEnded = false
+		}
+		//fmt.Println("ISVOTED", gameIn.IsVoted[sess.UserId])
+		//fmt.Println()
+	}
+	if duelVotingEnded {
+		// Результат дуэли доступен, пока не закончится голосование за следующую
+		game.ResultDuel = duel
+	}
+	mem.Mutex.Unlock()
+
+	// Ответ клиенту
+	sendStatus(req, StatusOk)
+
+	if duelVotingEnded {
+		mem.sendBroadcastMessage(session, "duelvotingended")
+		mem.waitGame(game, seconds(mem.config().SleepBetween))
+
+		//fmt.Println("!!! duelVotingEnded")
+		//fmt.Println()
+		mem.Mutex.Lock()
+		for _, sess := range game.Sessions {
+			userVoted := game.IsVoted[sess.UserId]
+			if userVoted {
+				game.IsVoted[sess.UserId] = false
+			}
+		}
+
+		// Броадкаст о том, что все ответили на все вопросы
+		roundVotingEnded := true
+		//fmt.Println(game.DuelNum, "VS", game.MaxUsersCnt)
+		if game.DuelNum+1 != game.MaxUsersCnt {
+			roundVotingEnded = false
+		}
+		if roundVotingEnded {
+			game.ResultRoundNum = game.RoundNum
+			game.setPhase(PhaseRoundResults)
+			for _, d := range game.Duels {
+				req.Log.Debug("round duel", "question", d.Question, "usernames", d.Usernames, "answers", d.Answers, "votes", d.Votes)
+			}
+		}
+		mem.Mutex.Unlock()
+		if roundVotingEnded {
+			mem.sendBroadcastMessage(session, "roundvotingended")
+			go mem.broadcastNewRoundStartedOrGameEnded(session) // go, чтоб клиент мог топ раунда
+		} else {
+			go mem.broadcastNewDuelVotingStarted(session) // go, чтоб клиент мог показать рез. дуэти
+		}
+	}
+}
+
+func (mem *Memory) broadcastNewDuelVotingStarted(session *Session) {
+	mem.Mutex.Lock()
+	game := mem.Games[session.GameId]
+	mem.Mutex.Unlock()
+	mem.waitGame(game, seconds(mem.config().SleepBetween))
+	mem.Mutex.Lock()
+	game.DuelNum += 1
+	mem.Mutex.Unlock()
+	mem.sendBroadcastMessage(session, "newduelvotingstarted")
+}
+
+func (mem *Memory) broadcastNewRoundStartedOrGameEnded(session *Session) {
+	mem.Mutex.Lock()
+	game := mem.Games[session.GameId]
+	mem.Mutex.Unlock()
+	mem.waitGame(game, seconds(mem.config().SleepBetween))
+	mem.Mutex.Lock()
+	if game.RoundNum+1 == game.MaxRoundsCnt {
+		game.setPhase(PhaseEnded)
+		gameLog(game).Info("game ended", "points", game.GameResult, "teams", game.TeamGameResult)
+		mem.Mutex.Unlock()
+		mem.sendBroadcastMessage(session, "gameended")
+		metrics.GamesFinished.Inc()
+		mem.updateRatings(game)
+		// Ждем людей, а не игру, поэтому по настоящим часам, как и таймауты соединений.
+		// Когда время на реванш вышло, закончившаяся комната больше не нужна.
+		if wait := mem.config().RematchWait; wait > 0 {
+			time.AfterFunc(seconds(wait), func() {
+				mem.decideRematch(game)
+				mem.removeGame(game)
+			})
+		} else {
+			time.AfterFunc(seconds(endedGameKeepConst), func() { mem.removeGame(game) })
+		}
+		return
+	}
+
+	// Новый раунд готовится до рассылки, как и первый
+	game.RoundNum += 1
+	game.DuelNum = 0
+	game.EveryoneAnswered = false
+	for _, sess := range game.Sessions {
+		game.QuestionNum[sess.UserId] = 0
+	}
+	game.Duels = []*Duel{}
+	mem.generateDuels(session)
+	mem.initResults(session)
+	game.setPhase(PhaseAnswering)
+	roundNum := game.RoundNum
+	mem.Mutex.Unlock()
+	mem.sendBroadcastMessage(session, "newroundstarted")
+	gameLog(game).Info("new round started", "roundnum", roundNum)
+}
+
+// removeGame убирает закончившуюся комнату из mem.Games. Кто так и остался в ней, больше ни в какой комнате.
+func (mem *Memory) removeGame(game *Game) {
+	mem.Mutex.Lock()
+	defer mem.Mutex.Unlock()
+	if mem.Games[game.GameId] != game {
+		return
+	}
+	delete(mem.Games, game.GameId)
+	for _, sess := range game.Sessions {
+		if sess.GameId == game.GameId {
+			sess.GameId = -1
+		}
+	}
+	metrics.RoomsByPhase.Dec(game.Phase)
+	gameLog(game).Debug("game removed")
+}
+
+func (mem *Memory) getDuelResultHandler(req *Request) {
+	session, err := mem.checkToken(req)
+	if err != nil {
+		req.Log.Error("invalid token", "err", err)
+		return
+	}
+
+	game := mem.startedGame(req, session)
+	if game == nil {
+		return
+	}
+	mem.Mutex.Lock()
+	// Нельзя запрашивать результаты, пока не закончилось голосование за первую дуэль
+	duel := game.ResultDuel
+	if duel == nil {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeNoDuelResult, "no duel of the round has ended yet"))
+		return
+	}
+
+	votesfor0, ok := duel.Votes[0]
+	if !ok {
+		votesfor0 = []string{}
+	}
+	votesfor1, ok := duel.Votes[1]
+	if !ok {
+		votesfor1 = []string{}
+	}
+	sendData, err := req.Codec.Marshal(&ResponseDuelResult{
+		Status:    StatusOk,
+		Question:  duel.Question,
+		Usernames: duel.Usernames,
+		Answers:   duel.Answers,
+		VotesFor0: votesfor0,
+		VotesFor1: votesfor1,
+		Author:    duel.Author,
+
+		Truth:         duel.Truth,
+		VotesForTruth: duel.Votes[truthPosConst],
+	})
+	mem.Mutex.Unlock()
+	if err != nil {
+		req.Log.Error("marshal response", "err", err)
+	}
+	_, err = req.ConnReq.Write(sendData)
+	if err != nil {
+		req.Log.Error("write response", "err", err)
+	}
+}
+
+func (mem *Memory) getRoundResultHandler(req *Request) {
+	session, err := mem.checkToken(req)
+	if err != nil {
+		req.Log.Error("invalid token", "err", err)
+		return
+	}
+
+	game := mem.startedGame(req, session)
+	if game == nil {
+		return
+	}
+	mem.Mutex.Lock()
+	roundNum := game.ResultRoundNum
+	sendData, err := req.Codec.Marshal(&ResponseRoundResult{
+		Status: StatusOk,
+		Points: game.RoundResult[roundNum],
+		Teams:  game.TeamRoundResult[roundNum],
+	})
+	mem.Mutex.Unlock()
+	if err != nil {
+		req.Log.Error("marshal response", "err", err)
+	}
+	_, err = req.ConnReq.Write(sendData)
+	if err != nil {
+		req.Log.Error("write response", "err", err)
+	}
+
+	req.Log.Debug("round result", "roundnum", roundNum)
+}
+
+func (mem *Memory) getGameResultHandler(req *Request) {
+	session, err := mem.checkToken(req)
+	if err != nil {
+		req.Log.Error("invalid token", "err", err)
+		return
+	}
+
+	game := mem.startedGame(req, session)
+	if game == nil {
+		return
+	}
+	mem.Mutex.Lock()
+	sendData, err := req.Codec.Marshal(&ResponseRoundResult{
+		Status: StatusOk,
+		Points: game.GameResult,
+		Teams:  game.TeamGameResult,
+	})
+	mem.Mutex.Unlock()
+	if err != nil {
+		req.Log.Error("marshal response", "err", err)
+	}
+	_, err = req.ConnReq.Write(sendData)
+	if err != nil {
+		req.Log.Error("write response", "err", err)
+	}
+
+	req.Log.Debug("game result")
+}
+
+var requestMethods = []string{
+	"hello",
+	"register",
+	"login",
+	"getusername",
+	"entergame",
+	"getquestion",
+	"saveanswer",
+	"getduel",
+	"savevote",
+	"getduelresult",
+	"getroundresult",
+	"getgameresult",
+	"sendchat",
+	"react",
+	"submitprompt",
+	"saveprompts",
+	"playagain",
+	"kick",
+	"roomsettings",
+	"startgame",
+	"pausegame",
+	"resumegame",
+	"jointeam",
+}
+
+func (mem *Memory) handleRequest(req *Request) {
+	if !mem.checkProtocol(req) {
+		return
+	}
+	switch req.Method {
+	case "hello":
+		mem.helloHandler(req)
+	case "register":
+		mem.registerHandler(req)
+	case "login":
+		mem.loginHandler(req)
+	case "getusername":
+		mem.getUsernameHandler(req)
+	case "entergame":
+		mem.enterGameHandler(req)
+	case "getquestion":
+		mem.getQuestionHandler(req)
+	case "saveanswer":
+		mem.saveAnswerHandler(req)
+	case "getduel":
+		mem.getDuelHandler(req)
+	case "savevote":
+		mem.saveVoteHandler(req)
+	case "getduelresult":
+		mem.getDuelResultHandler(req)
+	case "getroundresult":
+		mem.getRoundResultHandler(req)
+	case "getgameresult":
+		mem.getGameResultHandler(req)
+	case "sendchat":
+		mem.sendChatHandler(req)
+	case "react":
+		mem.reactHandler(req)
+	case "submitprompt":
+		mem.submitPromptHandler(req)
+	case "saveprompts":
+		mem.savePromptsHandler(req)
+	case "playagain":
+		mem.playAgainHandler(req)
+	case "kick":
+		mem.kickHandler(req)
+	case "roomsettings":
+		mem.roomSettingsHandler(req)
+	case "startgame":
+		mem.startGameHandler(req)
+	case "pausegame":
+		mem.pauseGameHandler(req)
+	case "resumegame":
+		mem.resumeGameHandler(req)
+	case "jointeam":
+		mem.joinTeamHandler(req)
+	}
+}
+
+func (mem *Memory) newClient(connReq net.Conn, connBrcast net.Conn) {
+	connId := mem.lastConnId.Add(1)
+	connLog := slog.With("conn_id", connId, "remote", connReq.RemoteAddr().String())
+	connLog.Info("client connected", "remote_brcast", connBrcast.RemoteAddr().String())
+	metrics.OpenConnections.Inc()
+	defer metrics.OpenConnections.Dec()
+	mem.Mutex.Lock()
+	mem.Conns[connId] = []net.Conn{connReq, connBrcast}
+	mem.Mutex.Unlock()
+
+	limiter := mem.Limiter.newConnLimiter(connReq)
+	client := newClientInfo()
+	reader := bufio.NewReader(connReq)
+	maxLineLen := mem.config().RateLimits.MaxLineLen
+
+	for {
+		data, err := readRequest(reader, int(maxLineLen))
+		if err != nil {
+			// После такой ошибки не найти начало следующего запроса, соединение закрывается
+			req := &Request{ConnId: connId, ConnReq: connReq, ConnBrcast: connBrcast, Client: client, Codec: client.codec(), Log: connLog}
+			if errors.Is(err, xocodec.ErrTooLarge) {
+				sendError(req, newError(ErrTooLarge, CodeRequestTooLarge, "request is longer than %d bytes", maxLineLen))
+			} else if errors.Is(err, xocodec.ErrInvalidMsgpack) {
+				sendError(req, newError(ErrBadRequest, CodeInvalidRequest, "request is not valid msgpack: %v", err))
+			}
+			break
+		}
+		connLog.Debug("message received", "data", string(data))
+		params, reqErr := parseRequest(data)
+		req := &Request{
+			ConnId:     connId,
+			Method:     params.Method,
+			ConnReq:    connReq,
+			ConnBrcast: connBrcast,
+			Params:     params,
+			Client:     client,
+			Codec:      client.codec(),
+			Start:      time.Now(),
+			Log:        connLog.With("method", params.Method),
+		}
+
+		// Слишком частые запросы отклоняются, а соединение, которое не перестает их слать, закрывается
+		if !limiter.Allow(req.Method) {
+			sendError(req, newError(ErrTooManyRequests, CodeRateLimited, "too many requests, slow down"))
+			if limiter.Abusive() {
+				connLog.Warn("rate limit abused, closing connection")
+				break
+			}
+			continue
+		}
+		go func() {
+			defer limiter.Done()
+			if reqErr != nil {
+				sendError(req, reqErr)
+			} else {
+				mem.handleRequest(req)
+			}
+			observeRequest(req)
+			req.Log.Info("request handled", "latency", time.Since(req.Start))
+		}()
+	}
+
+	// Соединение разорвано = Достигнут конец файла
+	connLog.Info("client disconnected")
+	connReq.Close()
+	connBrcast.Close()
+	mem.Mutex.Lock()
+	delete(mem.Conns, connId)
+	// Удалить сессию, если соединение разорвано
+	closed := []*Session{}
+	for _, s := range mem.Sessions {
+		if s.ConnReq == connReq {
+			delete(mem.Sessions, s.UserId)
+			closed = append(closed, s)
+		}
+	}
+	mem.Mutex.Unlock()
+	for _, s := range closed {
+		s.Outbox.Close()
+		mem.passHost(s)
+	}
+}
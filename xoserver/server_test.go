@@ -0,0 +1,204 @@
+package xoserver_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"Xo-xo-touch/xoclient"
+	"Xo-xo-touch/xoserver"
+)
+
+const (
+	playersCnt = 5
+	roundsCnt  = 3
+)
+
+func TestMain(m *testing.M) {
+	// Уровень логов из Config действует только на логгер сервера
+	slog.SetDefault(xoserver.NewLogger(os.Stderr, "text"))
+	os.Exit(m.Run())
+}
+
+// startServer поднимает сервер на свободных портах с FakeClock, так что паузы игры не ждутся
+func startServer(t *testing.T) *xoserver.Server {
+	t.Helper()
+	config := xoserver.DefaultConfig()
+	config.PortReq = 0
+	config.PortBrcast = 0
+	config.HttpAddr = ""
+	config.StateFile = ""
+	config.BannedWordsFile = ""
+	config.LogLevel = "error"
+	config.MaxUsersCnt = playersCnt
+	config.MaxRoundsCnt = roundsCnt
+	// Все клиенты теста ходят с одного ip
+	config.RateLimits.Connection = xoserver.RateLimit{Rate: 100000, Burst: 100000}
+	config.RateLimits.Ip = xoserver.RateLimit{Rate: 100000, Burst: 100000}
+
+	srv, err := xoserver.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetClock(xoserver.NewFakeClock(time.Now()))
+	err = srv.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Shutdown(0) })
+	return srv
+}
+
+type player struct {
+	Username string
+	Client   *xoclient.Client
+	Answers  map[string]bool
+}
+
+// waitAll ждет рассылку message у всех игроков
+func waitAll(ctx context.Context, t *testing.T, players []*player, message string) {
+	t.Helper()
+	for _, p := range players {
+		_, err := p.Client.WaitEvent(ctx, message)
+		if err != nil {
+			t.Fatalf("%s: wait %s: %v", p.Username, message, err)
+		}
+	}
+}
+
+func TestFullGame(t *testing.T) {
+	srv := startServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	// Сервер связывает соединения в пару по порядку, поэтому игроки подключаются по одному.
+	// Половина игроков говорит на MessagePack: рассылки одной игры идут в обеих кодировках.
+	players := []*player{}
+	for i := 0; i < playersCnt; i++ {
+		encoding := []string{"json", "msgpack"}[i%2]
+		c, err := xoclient.Dial(ctx, srv.ReqAddr(), srv.BrcastAddr(), &xoclient.Config{Encoding: encoding})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		if c.Server().Encoding != encoding {
+			t.Fatalf("player%d: server chose %q, want %q", i, c.Server().Encoding, encoding)
+		}
+		p := &player{Username: fmt.Sprintf("player%d", i), Client: c, Answers: map[string]bool{}}
+		_, err = c.Register(ctx, p.Username, "password")
+		if err != nil {
+			t.Fatalf("%s: register: %v", p.Username, err)
+		}
+		players = append(players, p)
+	}
+	for i, p := range players {
+		resp, err := p.Client.EnterGame(ctx)
+		if err != nil {
+			t.Fatalf("%s: entergame: %v", p.Username, err)
+		}
+		if len(resp.Usernames) != i {
+			t.Fatalf("%s: entergame: %d players in the room, want %d", p.Username, len(resp.Usernames), i)
+		}
+	}
+	waitAll(ctx, t, players, xoclient.EventGameStarted)
+
+	for round := int64(0); round < roundsCnt; round++ {
+		// Каждый отвечает на два вопроса
+		for _, p := range players {
+			for q := 0; q < 2; q++ {
+				_, err := p.Client.GetQuestion(ctx)
+				if err != nil {
+					t.Fatalf("round %d: %s: getquestion: %v", round, p.Username, err)
+				}
+				answer := fmt.Sprintf("r%d %s a%d", round, p.Username, q)
+				resp, err := p.Client.SaveAnswer(ctx, answer)
+				if err != nil {
+					t.Fatalf("round %d: %s: saveanswer: %v", round, p.Username, err)
+				}
+				if resp.LastAnswer != (q == 1) {
+					t.Fatalf("round %d: %s: lastanswer = %v after answer %d", round, p.Username, resp.LastAnswer, q)
+				}
+				p.Answers[answer] = true
+			}
+		}
+		waitAll(ctx, t, players, xoclient.EventEveryoneAnswered)
+
+		for duelNum := int64(0); duelNum < playersCnt; duelNum++ {
+			if duelNum > 0 {
+				waitAll(ctx, t, players, xoclient.EventNewDuelVotingStarted)
+			}
+			// С FakeClock следующая дуэль открывается сразу после последнего голоса,
+			// поэтому сначала все смотрят дуэль, а потом голосуют
+			duels := []*xoclient.ResponseDuel{}
+			for _, p := range players {
+				duel, err := p.Client.GetDuel(ctx)
+				if err != nil {
+					t.Fatalf("round %d duel %d: %s: getduel: %v", round, duelNum, p.Username, err)
+				}
+				if duel.DuelNum != duelNum {
+					t.Fatalf("round %d: %s: getduel returned duel %d, want %d", round, p.Username, duel.DuelNum, duelNum)
+				}
+				duels = append(duels, duel)
+			}
+			// Голосуют все, кроме двух участников дуэли
+			voters := 0
+			for i, p := range players {
+				if p.Answers[duels[i].Answers[0]] || p.Answers[duels[i].Answers[1]] {
+					continue
+				}
+				err := p.Client.SaveVote(ctx, 0)
+				if err != nil {
+					t.Fatalf("round %d duel %d: %s: savevote: %v", round, duelNum, p.Username, err)
+				}
+				voters += 1
+			}
+			if voters != playersCnt-2 {
+				t.Fatalf("round %d duel %d: %d voters, want %d", round, duelNum, voters, playersCnt-2)
+			}
+			waitAll(ctx, t, players, xoclient.EventDuelVotingEnded)
+
+			result, err := players[0].Client.GetDuelResult(ctx)
+			if err != nil {
+				t.Fatalf("round %d duel %d: getduelresult: %v", round, duelNum, err)
+			}
+			if len(result.VotesFor0) != playersCnt-2 || len(result.VotesFor1) != 0 {
+				t.Fatalf("round %d duel %d: votes %v / %v, want %d / 0", round, duelNum, result.VotesFor0, result.VotesFor1, playersCnt-2)
+			}
+		}
+		waitAll(ctx, t, players, xoclient.EventRoundVotingEnded)
+
+		result, err := players[0].Client.GetRoundResult(ctx)
+		if err != nil {
+			t.Fatalf("round %d: getroundresult: %v", round, err)
+		}
+		sum := int64(0)
+		for _, points := range result.Points {
+			sum += points
+		}
+		// Каждая дуэль приносит (playersCnt-2) голоса по 10*(round+1)
+		want := playersCnt * (playersCnt - 2) * 10 * (round + 1)
+		if len(result.Points) != playersCnt || sum != want {
+			t.Fatalf("round %d: points %v, sum %d, want %d", round, result.Points, sum, want)
+		}
+
+		if round+1 < roundsCnt {
+			waitAll(ctx, t, players, xoclient.EventNewRoundStarted)
+		}
+	}
+	waitAll(ctx, t, players, xoclient.EventGameEnded)
+
+	result, err := players[0].Client.GetGameResult(ctx)
+	if err != nil {
+		t.Fatalf("getgameresult: %v", err)
+	}
+	sum := int64(0)
+	for _, points := range result.Points {
+		sum += points
+	}
+	if sum != 900 {
+		t.Fatalf("game points %v, sum %d, want 900", result.Points, sum)
+	}
+}
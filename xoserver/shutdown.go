@@ -0,0 +1,116 @@
+package xoserver
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"time"
+)
+
+type ResponseShutdown struct {
+	Message string  `json:"message"`
+	Grace   float64 `json:"grace"` // seconds
+}
+
+// acceptClients принимает пары соединений, пока слушатели не закроют
+func (mem *Memory) acceptClients(lnReq net.Listener, lnBrcast net.Listener) {
+	for {
+		//Accept port
+		connReq, err := lnReq.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			slog.Error("accept request connection", "err", err)
+			continue
+		}
+
+		connBrcast, err := lnBrcast.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			connReq.Close()
+			return
+		}
+		if err != nil {
+			slog.Error("accept broadcast connection", "err", err)
+			connReq.Close()
+			continue
+		}
+
+		go mem.newClient(connReq, connBrcast)
+	}
+}
+
+// runningGamesCnt - сколько игр уже началось, но еще не закончилось
+func (mem *Memory) runningGamesCnt() int64 {
+	mem.Mutex.Lock()
+	defer mem.Mutex.Unlock()
+	cnt := int64(0)
+	for _, game := range mem.Games {
+		if game.IsGameStarted && game.Phase != PhaseEnded {
+			cnt += 1
+		}
+	}
+	return cnt
+}
+
+// shutdown останавливает сервер: новые соединения и комнаты больше не принимаются,
+// идущие игры доигрываются (но не дольше grace), состояние сохраняется, соединения закрываются
+func (mem *Memory) shutdown(listeners []net.Listener, grace time.Duration) {
+	slog.Info("shutting down", "grace", grace)
+	mem.Draining.Store(true)
+	for _, ln := range listeners {
+		ln.Close()
+	}
+
+	// Предупредить всех игроков
+	mem.Mutex.Lock()
+	for _, sess := range mem.Sessions {
+		sendData, err := sess.Client.codec().Marshal(&ResponseShutdown{Message: "servershuttingdown", Grace: grace.Seconds()})
+		if err != nil {
+			slog.Error("marshal broadcast", "err", err)
+		}
+		sess.Outbox.Send(sendData)
+	}
+	mem.Mutex.Unlock()
+
+	// Дождаться конца идущих игр
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for mem.runningGamesCnt() > 0 {
+		select {
+		case <-ctx.Done():
+			slog.Warn("grace period is over, games are cut off", "games", mem.runningGamesCnt())
+		case <-ticker.C:
+			continue
+		}
+		break
+	}
+
+	err := mem.flushState()
+	if err != nil {
+		slog.Error("flush state", "file", mem.Store.Path, "err", err)
+	}
+	mem.Limiter.Stop()
+
+	// Закрыть соединения клиентов, дав очередям дописать последние сообщения
+	mem.Mutex.Lock()
+	outboxes := []*Outbox{}
+	for _, sess := range mem.Sessions {
+		outboxes = append(outboxes, sess.Outbox)
+	}
+	mem.Mutex.Unlock()
+	for _, o := range outboxes {
+		o.Drain(time.Second)
+	}
+	mem.Mutex.Lock()
+	for _, conns := range mem.Conns {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}
+	mem.Mutex.Unlock()
+	slog.Info("server stopped")
+}
@@ -0,0 +1,119 @@
+package xoserver
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Store сохраняет зарегистрированных пользователей в json-файл, чтобы они переживали перезапуск
+type Store struct {
+	Mutex *sync.Mutex
+	Path  string
+	Dirty bool
+}
+
+type StoredState struct {
+	Users []*User `json:"users"`
+}
+
+func newStore(path string) *Store {
+	return &Store{
+		Mutex: &sync.Mutex{},
+		Path:  path,
+	}
+}
+
+func (st *Store) Load() (*StoredState, error) {
+	state := &StoredState{Users: []*User{}}
+	if st.Path == "" {
+		return state, nil
+	}
+	data, err := os.ReadFile(st.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Save пишет состояние во временный файл и переименовывает его, чтобы не оставить файл наполовину записанным
+func (st *Store) Save(state *StoredState) error {
+	if st.Path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := st.Path + ".tmp"
+	err = os.WriteFile(tmp, data, 0o600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, st.Path)
+}
+
+func (st *Store) MarkDirty() {
+	st.Mutex.Lock()
+	st.Dirty = true
+	st.Mutex.Unlock()
+}
+
+func (mem *Memory) loadState() error {
+	state, err := mem.Store.Load()
+	if err != nil {
+		return err
+	}
+	mem.Mutex.Lock()
+	for _, u := range state.Users {
+		mem.Users[u.UserId] = u
+	}
+	mem.Mutex.Unlock()
+	slog.Info("state loaded", "file", mem.Store.Path, "users", len(state.Users))
+	return nil
+}
+
+// flushState сохраняет состояние, если оно менялось с прошлого сохранения
+func (mem *Memory) flushState() error {
+	mem.Store.Mutex.Lock()
+	defer mem.Store.Mutex.Unlock()
+	if !mem.Store.Dirty {
+		return nil
+	}
+
+	state := &StoredState{Users: []*User{}}
+	mem.Mutex.Lock()
+	for _, u := range mem.Users {
+		if u.Bot {
+			continue
+		}
+		state.Users = append(state.Users, u)
+	}
+	mem.Mutex.Unlock()
+
+	err := mem.Store.Save(state)
+	if err != nil {
+		return err
+	}
+	mem.Store.Dirty = false
+	return nil
+}
+
+func (mem *Memory) flushStatePeriodically(interval time.Duration) {
+	for range time.Tick(interval) {
+		err := mem.flushState()
+		if err != nil {
+			slog.Error("flush state", "file", mem.Store.Path, "err", err)
+		}
+	}
+}
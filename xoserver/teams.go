@@ -0,0 +1,201 @@
+package xoserver
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// Командная игра. Игроки делятся на Game.TeamsCnt равных команд: пока комната собирается,
+// можно выбрать команду самому (jointeam), остальных при старте распределяет сервер так,
+// чтобы суммы рейтингов команд были поближе. В дуэли всегда игроки разных команд,
+// очки игрока идут и его команде.
+
+var teamNames = []string{"red", "blue", "green", "yellow"}
+
+type ResponseTeamChanged struct {
+	Message  string `json:"message"`
+	Username string `json:"username"`
+	Team     string `json:"team"`
+}
+
+type ResponseTeams struct {
+	Message string              `json:"message"`
+	Members map[string][]string `json:"members"` // команда -> игроки
+}
+
+func (mem *Memory) joinTeamHandler(req *Request) {
+	session, err := mem.checkToken(req)
+	if err != nil {
+		req.Log.Error("invalid token", "err", err)
+		return
+	}
+
+	mem.Mutex.Lock()
+	game := mem.Games[session.GameId]
+	username := mem.Users[session.UserId].Username
+	if game == nil {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeNotInGame, "enter a game first"))
+		return
+	}
+	if game.TeamsCnt == 0 {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeTeamsDisabled, "this room plays without teams"))
+		return
+	}
+	if game.Phase != PhaseLobby {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrMethodIsNotAllowed, CodeNotInLobby, "teams are picked before the game starts"))
+		return
+	}
+	team := req.Params.Team
+	if !containsString(teamNames[:game.TeamsCnt], team) {
+		mem.Mutex.Unlock()
+		sendError(req, badRequest("team", "no team %q in this room", team))
+		return
+	}
+
+	members := 0
+	for userId := range game.Sessions {
+		name := mem.Users[userId].Username
+		if name != username && game.Teams[name] == team {
+			members += 1
+		}
+	}
+	if int64(members) >= game.MaxUsersCnt/game.TeamsCnt {
+		mem.Mutex.Unlock()
+		sendError(req, newError(ErrAlreadyd, CodeTeamFull, "team %s is full", team))
+		return
+	}
+	game.Teams[username] = team
+	mem.Mutex.Unlock()
+	req.Log.Debug("team picked", "username", username, "team", team)
+
+	sendStatus(req, StatusOk)
+	mem.sendGameBroadcast(game, &ResponseTeamChanged{Message: "teamchanged", Username: username, Team: team})
+}
+
+// checkTeams - можно ли начать командную игру с playersCnt игроками: nil, если можно
+func checkTeams(teamsCnt int64, playersCnt int64) *ResponseError {
+	if teamsCnt == 0 {
+		return nil
+	}
+	if playersCnt < minTeamUsersConst || playersCnt > maxTeamUsersConst {
+		return newError(ErrMethodIsNotAllowed, CodeUnevenTeams, "a team game needs %d to %d players", minTeamUsersConst, maxTeamUsersConst)
+	}
+	if playersCnt%teamsCnt != 0 {
+		return newError(ErrMethodIsNotAllowed, CodeUnevenTeams, "%d players can not be split into %d equal teams", playersCnt, teamsCnt)
+	}
+	return nil
+}
+
+// assignTeams делит игроков на команды перед началом игры и возвращает состав команд.
+// Выбор игрока остается, пока в команде есть место, раньше вошедшие - первыми.
+// Остальные по убыванию рейтинга идут в команду с наименьшей суммой рейтингов.
+// Вызывается под mem.Mutex.
+func (mem *Memory) assignTeams(game *Game) map[string][]string {
+	size := len(game.Sessions) / int(game.TeamsCnt)
+	teams := map[string][]string{}
+	ratings := map[string]int64{}
+	rest := []*User{}
+	for _, userId := range game.Joined {
+		if game.Sessions[userId] == nil {
+			continue
+		}
+		user := mem.Users[userId]
+		team, ok := game.Teams[user.Username]
+		if ok && len(teams[team]) < size {
+			teams[team] = append(teams[team], user.Username)
+			ratings[team] += user.Rating
+			continue
+		}
+		rest = append(rest, user)
+	}
+	sort.SliceStable(rest, func(i, j int) bool { return rest[i].Rating > rest[j].Rating })
+	for _, user := range rest {
+		best := ""
+		for _, team := range teamNames[:game.TeamsCnt] {
+			if len(teams[team]) < size && (best == "" || ratings[team] < ratings[best]) {
+				best = team
+			}
+		}
+		teams[best] = append(teams[best], user.Username)
+		ratings[best] += user.Rating
+	}
+
+	game.Teams = map[string]string{}
+	for team, usernames := range teams {
+		for _, username := range usernames {
+			game.Teams[username] = team
+		}
+	}
+	gameLog(game).Info("teams assigned", "teams", teams, "ratings", ratings)
+	return teams
+}
+
+// interleaveTeams выстраивает игроков по кругу через одного из каждой команды: red, blue, red, blue...
+// Команды равные, поэтому соседи, в том числе последний и первый, всегда из разных команд.
+// Вызывается под mem.Mutex.
+func interleaveTeams(game *Game, users map[string]string) []string {
+	byTeam := map[string][]string{}
+	for userId, username := range users {
+		team := game.Teams[username]
+		byTeam[team] = append(byTeam[team], userId)
+	}
+	order := append([]string{}, teamNames[:game.TeamsCnt]...)
+	rand.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+	for _, team := range order {
+		members := byTeam[team]
+		rand.Shuffle(len(members), func(i, j int) { members[i], members[j] = members[j], members[i] })
+	}
+
+	userIds := []string{}
+	for i := 0; len(userIds) < len(users); i++ {
+		for _, team := range order {
+			if i < len(byTeam[team]) {
+				userIds = append(userIds, byTeam[team][i])
+			}
+		}
+	}
+	return userIds
+}
+
+// usernames - userId -> username для userIds. Вызывается под mem.Mutex.
+func (mem *Memory) usernames(userIds []string) map[string]string {
+	users := map[string]string{}
+	for _, userId := range userIds {
+		users[userId] = mem.Users[userId].Username
+	}
+	return users
+}
+
+// addPoints добавляет очки игроку в результат раунда и игры, а в командной игре - и его команде.
+// Вызывается под mem.Mutex.
+func addPoints(game *Game, username string, points int64) {
+	game.RoundResult[game.RoundNum][username] += points
+	game.GameResult[username] += points
+	if team, ok := game.Teams[username]; ok && game.TeamsCnt > 0 {
+		game.TeamRoundResult[game.RoundNum][team] += points
+		game.TeamGameResult[team] += points
+	}
+}
+
+// updateRatings после игры пересчитывает рейтинги игроков: среднее очков, где последние игры весят больше
+func (mem *Memory) updateRatings(game *Game) {
+	mem.Mutex.Lock()
+	for userId := range game.Sessions {
+		user := mem.Users[userId]
+		if user.Bot {
+			continue
+		}
+		points := game.GameResult[user.Username]
+		if user.GamesPlayed == 0 {
+			user.Rating = points
+		} else {
+			user.Rating = (user.Rating*3 + points) / 4
+		}
+		user.GamesPlayed += 1
+	}
+	mem.Mutex.Unlock()
+	mem.Store.MarkDirty()
+}
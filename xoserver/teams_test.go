@@ -0,0 +1,106 @@
+package xoserver
+
+import (
+	"testing"
+)
+
+// teamLobbyConfig - комната на две команды по двое
+func teamLobbyConfig() *Config {
+	config := testConfig()
+	config.MaxUsersCnt = 4
+	config.Teams = 2
+	return config
+}
+
+func TestJoinTeam(t *testing.T) {
+	mem, players := newTestLobby(t, teamLobbyConfig(), 4, 3)
+
+	tests := []struct {
+		p    *testPlayer
+		team string
+		code any
+	}{
+		{players[0], "red", nil},
+		{players[1], "green", CodeInvalidRequest},
+		{players[1], "red", nil},
+		{players[2], "red", CodeTeamFull},
+		{players[0], "red", nil}, // уже в этой команде
+		{players[0], "blue", nil},
+		{players[2], "red", nil},
+		{players[3], "red", CodeNotInGame},
+	}
+	for i, tt := range tests {
+		if resp := tt.p.send(mem, RequestParams{Method: "jointeam", Team: tt.team}); resp["code"] != tt.code {
+			t.Fatalf("%d: jointeam %s: %v, want %v", i, tt.team, resp, tt.code)
+		}
+	}
+
+	// Четвертый получает единственное свободное место
+	players[3].send(mem, RequestParams{Method: "entergame"})
+	mem.Mutex.Lock()
+	game := mem.Games[0]
+	mem.Mutex.Unlock()
+	waitPhase(t, mem, game, PhaseAnswering)
+	mem.Mutex.Lock()
+	want := map[string]string{"player0": "blue", "player1": "red", "player2": "red", "player3": "blue"}
+	for username, team := range want {
+		if game.Teams[username] != team {
+			t.Errorf("%s in team %q, want %s", username, game.Teams[username], team)
+		}
+	}
+	for _, duel := range game.Duels {
+		if game.Teams[duel.Usernames[0]] == game.Teams[duel.Usernames[1]] {
+			t.Errorf("duel of teammates %v", duel.Usernames)
+		}
+	}
+	mem.Mutex.Unlock()
+	if resp := players[0].send(mem, RequestParams{Method: "jointeam", Team: "red"}); resp["code"] != CodeNotInLobby {
+		t.Fatalf("jointeam after the start: %v", resp)
+	}
+}
+
+func TestJoinTeamDisabled(t *testing.T) {
+	mem, players := newTestLobby(t, hostLobbyConfig(), 3, 1)
+	if resp := players[0].send(mem, RequestParams{Method: "jointeam", Team: "red"}); resp["code"] != CodeTeamsDisabled {
+		t.Fatalf("jointeam without teams: %v", resp)
+	}
+	if resp := players[0].send(mem, RequestParams{Method: "roomsettings", Teams: int64Param(2)}); resp["field"] != "teams" {
+		t.Fatalf("2 teams in a room of 5: %v", resp)
+	}
+	if resp := players[0].send(mem, RequestParams{Method: "roomsettings", Teams: int64Param(1), MaxUsers: int64Param(4)}); resp["field"] != "teams" {
+		t.Fatalf("1 team: %v", resp)
+	}
+	if resp := players[0].send(mem, RequestParams{Method: "roomsettings", Teams: int64Param(2), MaxUsers: int64Param(4)}); resp["status"] != float64(StatusOk) {
+		t.Fatalf("roomsettings: %v", resp)
+	}
+	if resp := players[0].send(mem, RequestParams{Method: "jointeam", Team: "blue"}); resp["status"] != float64(StatusOk) {
+		t.Fatalf("jointeam: %v", resp)
+	}
+}
+
+func TestAssignTeams(t *testing.T) {
+	mem, _ := newTestLobby(t, teamLobbyConfig(), 4, 4)
+	mem.Mutex.Lock()
+	game := mem.Games[0]
+	mem.Mutex.Unlock()
+	waitPhase(t, mem, game, PhaseAnswering)
+
+	ratings := map[string]int64{"player0": 100, "player1": 90, "player2": 10, "player3": 0}
+	mem.Mutex.Lock()
+	defer mem.Mutex.Unlock()
+	for _, user := range mem.Users {
+		user.Rating = ratings[user.Username]
+	}
+	game.Teams = map[string]string{}
+	mem.assignTeams(game)
+	if game.Teams["player0"] != game.Teams["player3"] || game.Teams["player1"] != game.Teams["player2"] || game.Teams["player0"] == game.Teams["player1"] {
+		t.Fatalf("teams %v, want 100+0 against 90+10", game.Teams)
+	}
+
+	// Очки игрока идут и его команде
+	team := game.Teams["player2"]
+	addPoints(game, "player2", 20)
+	if game.RoundResult[game.RoundNum]["player2"] != 20 || game.TeamRoundResult[game.RoundNum][team] != 20 || game.TeamGameResult[team] != 20 {
+		t.Fatalf("points %v, team points %v", game.RoundResult, game.TeamGameResult)
+	}
+}
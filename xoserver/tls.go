@@ -0,0 +1,34 @@
+package xoserver
+
+import (
+	"crypto/tls"
+	"net"
+	"strconv"
+)
+
+// newTlsConfig загружает сертификат для игровых портов. Без сертификата возвращает nil - обычный TCP.
+func newTlsConfig(certFile string, keyFile string) (*tls.Config, error) {
+	if certFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// listen открывает порт, с TLS, если он настроен
+func listen(port int64, tlsConfig *tls.Config) (net.Listener, error) {
+	ln, err := net.Listen("tcp", ":"+strconv.FormatInt(port, 10))
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		return tls.NewListener(ln, tlsConfig), nil
+	}
+	return ln, nil
+}